@@ -0,0 +1,130 @@
+package file_cleaner
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ActionMkdir creates the directory To and its parents
+	ActionMkdir = "mkdir"
+	// ActionMove moves the file From to To, Keep is the file it was found equal to, empty for an ingested file
+	ActionMove = "mv"
+	// ActionSymlink creates the symlink To that points to From
+	ActionSymlink = "ln"
+)
+
+/*
+Action is one file operation of a strategy. A real run executes the actions,
+a dry run only lists them in the report, so a script of a dry run does what the real run would do.
+*/
+type Action struct {
+	Kind string `json:"kind"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Keep string `json:"keep,omitempty"`
+}
+
+// duplicateActions returns the actions that move a duplicate to trash and replace it with a symlink if requested
+func duplicateActions(clean FileEntry, keep FileEntry, trashPath string, symlink bool) []Action {
+	actions := []Action{
+		{Kind: ActionMkdir, To: filepath.Dir(trashPath)},
+		{Kind: ActionMove, From: clean.path, To: trashPath, Keep: keep.path},
+	}
+	if symlink {
+		actions = append(actions, Action{Kind: ActionSymlink, From: keep.path, To: clean.path})
+	}
+	return actions
+}
+
+/*
+ingestActions returns the actions that move a unique file to its destination. If trashPath is set,
+the identical file at the destination is moved to trash first, Keep is the file that replaces it.
+*/
+func ingestActions(path string, destination string, trashPath string) []Action {
+	var actions []Action
+	if trashPath != "" {
+		actions = append(actions,
+			Action{Kind: ActionMkdir, To: filepath.Dir(trashPath)},
+			Action{Kind: ActionMove, From: destination, To: trashPath, Keep: path})
+	}
+	return append(actions,
+		Action{Kind: ActionMkdir, To: filepath.Dir(destination)},
+		Action{Kind: ActionMove, From: path, To: destination})
+}
+
+// run executes the action on the file system
+func (action Action) run(fsys FileSystem) error {
+	switch action.Kind {
+	case ActionMkdir:
+		return fsys.MkdirAll(FSName(action.To), fs.ModePerm)
+	case ActionMove:
+		return fsys.Rename(FSName(action.From), FSName(action.To))
+	case ActionSymlink:
+		return fsys.Symlink(action.From, FSName(action.To))
+	}
+	return fmt.Errorf("unknown action: %s", action.Kind)
+}
+
+// shellQuote quotes the string for a POSIX shell, nothing inside single quotes is expanded
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// scriptHeader stops the script at the first file that is not as it was in the dry run
+const scriptHeader = `#!/bin/sh
+# Actions of a file_cleaner dry run, review them before running the script.
+# Each file is compared with the kept file by cmp right before it is moved,
+# the script stops at the first file that changed or a destination that already exists.
+set -eu
+
+command -v cmp >/dev/null || { echo "cmp is required" >&2; exit 1; }
+
+same() {
+	if ! cmp -s -- "$1" "$2"; then
+		echo "not equal to the kept file, stopped: $1 $2" >&2
+		exit 1
+	fi
+}
+
+absent() {
+	if [ -e "$1" ] || [ -L "$1" ]; then
+		echo "destination already exists, stopped: $1" >&2
+		exit 1
+	fi
+}
+`
+
+/*
+WriteScript writes the actions of the report as a POSIX shell script,
+usually of a dry run, so the changes can be audited and run by hand.
+*/
+func (report *Report) WriteScript(writer io.Writer) error {
+	var script strings.Builder
+	script.WriteString(scriptHeader)
+	for _, strategy := range report.Strategies {
+		fmt.Fprintf(&script, "\n# strategy %q\n", strategy.Name)
+		for _, action := range strategy.Actions {
+			switch action.Kind {
+			case ActionMkdir:
+				fmt.Fprintf(&script, "mkdir -p -- %s\n", shellQuote(action.To))
+			case ActionMove:
+				// a file moved into the target has no kept file to compare with
+				if action.Keep != "" {
+					fmt.Fprintf(&script, "same %s %s\n", shellQuote(action.From), shellQuote(action.Keep))
+				}
+				fmt.Fprintf(&script, "absent %s\n", shellQuote(action.To))
+				fmt.Fprintf(&script, "mv -- %s %s\n", shellQuote(action.From), shellQuote(action.To))
+			case ActionSymlink:
+				fmt.Fprintf(&script, "ln -s -- %s %s\n", shellQuote(action.From), shellQuote(action.To))
+			default:
+				return fmt.Errorf("unknown action: %s", action.Kind)
+			}
+		}
+	}
+	_, err := io.WriteString(writer, script.String())
+	return err
+}
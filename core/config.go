@@ -8,13 +8,59 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
 
+// SymlinkPolicy controls how ListFiles handles symbolic links inside a DirEntry
+type SymlinkPolicy string
+
+const (
+	// SymlinkSkip ignores symbolic links, this is the default
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkFollow indexes the referent of the link and descends into linked directories
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkAsLink lists the link itself, it is never used as a duplicate candidate
+	SymlinkAsLink SymlinkPolicy = "as_link"
+)
+
+// parseSymlinkPolicy validates the `symlinks` value of a DirEntry
+func parseSymlinkPolicy(value string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(value); policy {
+	case SymlinkSkip, SymlinkFollow, SymlinkAsLink:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown symlink policy: %s", value)
+	}
+}
+
+// VerifyMode controls how much a strategy reads before it decides two files are duplicates
+type VerifyMode string
+
+const (
+	// VerifySizeHash trusts the same size and SHA-256 hash, the files are not compared byte by byte
+	VerifySizeHash VerifyMode = "size+hash"
+	// VerifyHashBytes compares the MD5 hash and then every byte, this is the default
+	VerifyHashBytes VerifyMode = "hash+bytes"
+	// VerifyParanoid is VerifyHashBytes, both files are compared again right before the duplicate is moved
+	VerifyParanoid VerifyMode = "paranoid"
+)
+
+// parseVerifyMode validates the `verify` value of a strategy
+func parseVerifyMode(value string) (VerifyMode, error) {
+	switch mode := VerifyMode(value); mode {
+	case VerifySizeHash, VerifyHashBytes, VerifyParanoid:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown verify mode: %s", value)
+	}
+}
+
 type DirEntry struct {
 	path        string
 	recursively bool
+	symlinks    SymlinkPolicy
 
 	// result of List include dirs
 	include_dirs bool // placeholder for future use
@@ -25,54 +71,196 @@ type DirEntry struct {
 
 type StrategyConfig struct {
 	name string
-	// Strategy allow `source_to_target_dedupe` and `pdf_mover`
+	// Strategy is a name registered by RegisterStrategy, e.g. `source_to_target_dedupe`
 	strategy string
 }
 
 type SourceToTargetDedupeStrategy struct {
 	super     StrategyConfig
-	target    DirEntry
+	targets   []DirEntry
 	source    []DirEntry
+	trashRoot string
+
+	// trashPath is the trash session of the current run, a timestamp directory below trashRoot
 	trashPath string
+
+	// ingest moves the unique source files into the target, nil if disabled
+	ingest *IngestConfig
+
+	// verify is how duplicates are confirmed, VerifyHashBytes if not set
+	verify VerifyMode
 }
 
 type Config struct {
 	version    string
 	strategies map[string]Strategy
+
+	// schedules of the strategies for the daemon mode, set by the `schedule` key
+	schedules map[string]string
+
+	// fsys the strategies run on, nil is the OS file system
+	fsys FileSystem
+
+	// decider confirms each duplicate group, nil keeps the default
+	decider Decider
 }
 
 // print dir entry
 func (dir *DirEntry) Print() {
-	fmt.Println("Path:", dir.path, "Recursively:", dir.recursively, "IncludeDirs:", dir.include_dirs)
+	logln("Path:", dir.path, "Recursively:", dir.recursively, "IncludeDirs:", dir.include_dirs, "Symlinks:", dir.symlinks)
+}
+
+/*
+NewSourceToTargetDedupeStrategy creates the `source_to_target_dedupe` strategy without a config file,
+trashDir is the `trash_dir`, `~` is expanded.
+*/
+func NewSourceToTargetDedupeStrategy(name string, targets []DirEntry, sources []DirEntry, trashDir string) (*SourceToTargetDedupeStrategy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("at least one target is required")
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("at least one source is required")
+	}
+	if trashDir == "" {
+		return nil, errors.New("trash dir is required")
+	}
+
+	strategy := new(SourceToTargetDedupeStrategy)
+	strategy.super = StrategyConfig{name: name, strategy: "source_to_target_dedupe"}
+	strategy.targets = append(strategy.targets, targets...)
+	strategy.source = append(strategy.source, sources...)
+	strategy.trashRoot = expandDir(trashDir)
+	strategy.verify = VerifyHashBytes
+	return strategy, nil
+}
+
+// SetVerify sets how duplicates are confirmed, see VerifyMode
+func (config *SourceToTargetDedupeStrategy) SetVerify(mode VerifyMode) error {
+	mode, err := parseVerifyMode(string(mode))
+	if err != nil {
+		return err
+	}
+	config.verify = mode
+	return nil
+}
+
+/*
+SetIngest enables the `ingest` option, dir is the destination directory and template the destination path,
+see PathTemplate. The collision policy defaults to CollisionSkip.
+*/
+func (config *SourceToTargetDedupeStrategy) SetIngest(dir string, template string, collision CollisionPolicy) error {
+	mover, err := NewMover(expandDir(dir), template, collision)
+	if err != nil {
+		return err
+	}
+	config.ingest = &IngestConfig{mover: mover, rule: config.super.name}
+	return nil
 }
 
 // Load a strategy entry
 func (config *SourceToTargetDedupeStrategy) Load(name string, value map[string]interface{}) error {
 	config.super.name = name
 	config.super.strategy = value["strategy"].(string)
-	fmt.Println("Strategy:", config.super.strategy)
+	logln("Strategy:", config.super.strategy)
+
+	// Load target directories, `target_dir` is kept for a single target
+	var targetDirs []interface{}
+	if targetDir, ok := value["target_dir"]; ok {
+		targetDirs = append(targetDirs, targetDir)
+	}
+	if list, ok := value["target_dirs"].([]interface{}); ok {
+		targetDirs = append(targetDirs, list...)
+	}
+	if len(targetDirs) == 0 {
+		return errors.New("target_dir or target_dirs is required")
+	}
 
-	config.target.Load(value["target_dir"].(map[string]interface{}))
-	config.target.Print()
+	for _, targetDir := range targetDirs {
+		dir := DirEntry{}
+		if err := dir.Load(targetDir.(map[string]interface{})); err != nil {
+			return err
+		}
+		dir.Print()
+		config.targets = append(config.targets, dir)
+	}
 
-	config.trashPath = value["trash_dir"].(string)
-	config.trashPath = expandDir(config.trashPath)
-	currentTime := time.Now()
-	formattedTime := currentTime.Format("2006-01-02-15-04-05.000")
-	config.trashPath = filepath.Join(config.trashPath, formattedTime)
-	fmt.Println("Trash Path:", config.trashPath)
+	config.trashRoot = value["trash_dir"].(string)
+	config.trashRoot = expandDir(config.trashRoot)
+	logln("Trash Dir:", config.trashRoot)
 
 	// Load source directories
 	sourceDirs := value["source_dirs"].([]interface{})
 	for _, sourceDir := range sourceDirs {
 		dir := DirEntry{}
-		dir.Load(sourceDir.(map[string]interface{}))
+		if err := dir.Load(sourceDir.(map[string]interface{})); err != nil {
+			return err
+		}
 		dir.Print()
 		config.source = append(config.source, dir)
 	}
+
+	// Load verify mode, compare every byte by default
+	config.verify = VerifyHashBytes
+	if verify, ok := value["verify"]; ok {
+		mode, err := parseVerifyMode(verify.(string))
+		if err != nil {
+			return err
+		}
+		config.verify = mode
+	}
+	logln("Verify:", config.verify)
+
+	// Load ingest option if it exists
+	if ingest, ok := value["ingest"]; ok {
+		config.ingest = new(IngestConfig)
+		if err := config.ingest.Load(name, ingest.(map[string]interface{}), config.targets); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+/*
+Value returns the config entry of the strategy, Load reads it back.
+The ingest option is not included.
+*/
+func (config *SourceToTargetDedupeStrategy) Value() map[string]interface{} {
+	value := map[string]interface{}{
+		"strategy":  "source_to_target_dedupe",
+		"trash_dir": config.trashRoot,
+	}
+	if config.super.strategy != "" {
+		value["strategy"] = config.super.strategy
+	}
+	if config.verify != "" && config.verify != VerifyHashBytes {
+		value["verify"] = string(config.verify)
+	}
+
+	if len(config.targets) == 1 {
+		value["target_dir"] = config.targets[0].Value()
+	} else {
+		var targets []interface{}
+		for i := range config.targets {
+			targets = append(targets, config.targets[i].Value())
+		}
+		value["target_dirs"] = targets
+	}
+
+	var sources []interface{}
+	for i := range config.source {
+		sources = append(sources, config.source[i].Value())
+	}
+	value["source_dirs"] = sources
+	return value
+}
+
+// newTrashSession starts a new trash directory named by the current time
+func (config *SourceToTargetDedupeStrategy) newTrashSession() {
+	currentTime := time.Now()
+	formattedTime := currentTime.Format("2006-01-02-15-04-05.000")
+	config.trashPath = filepath.Join(config.trashRoot, formattedTime)
+}
+
 /*
 this function expands the directory path
 supports ~ and ~/ expansion
@@ -92,34 +280,120 @@ func expandDir(path string) string {
 // create dir entry
 func CreateDirEntry(path string, recursively bool) DirEntry {
 	// current not support return include_dirs just placeholder
-	return DirEntry{path: path, recursively: recursively, include_dirs: false}
+	return DirEntry{path: path, recursively: recursively, include_dirs: false, symlinks: SymlinkSkip}
+}
+
+// NewDirEntry creates a dir entry like the config file does, `~` is expanded to the home directory
+func NewDirEntry(path string, recursively bool) DirEntry {
+	return CreateDirEntry(expandDir(path), recursively)
+}
+
+// Path returns the directory of the dir entry
+func (dirEntry *DirEntry) Path() string {
+	return dirEntry.path
+}
+
+// Recursively returns true if sub directories are listed
+func (dirEntry *DirEntry) Recursively() bool {
+	return dirEntry.recursively
+}
+
+// SetIgnore sets the `ignore` regex, files matching it are not listed. An empty pattern removes it.
+func (dirEntry *DirEntry) SetIgnore(pattern string) error {
+	regex, err := compileOptional(pattern)
+	if err != nil {
+		return err
+	}
+	dirEntry.ignore_regex = regex
+	return nil
+}
+
+// SetMatch sets the `match` regex, only files matching it are listed. An empty pattern removes it.
+func (dirEntry *DirEntry) SetMatch(pattern string) error {
+	regex, err := compileOptional(pattern)
+	if err != nil {
+		return err
+	}
+	dirEntry.match_regex = regex
+	return nil
+}
+
+// compileOptional compiles the regex, an empty pattern is nil
+func compileOptional(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// SetSymlinkPolicy changes how symbolic links inside the dir entry are listed
+func (dirEntry *DirEntry) SetSymlinkPolicy(policy SymlinkPolicy) error {
+	policy, err := parseSymlinkPolicy(string(policy))
+	if err != nil {
+		return err
+	}
+	dirEntry.symlinks = policy
+	return nil
 }
 
 // Load DirEntry
-func (dirEntry *DirEntry) Load(value map[string]interface{}) {
+func (dirEntry *DirEntry) Load(value map[string]interface{}) error {
 	dirEntry.path = value["path"].(string)
 	dirEntry.path = expandDir(dirEntry.path)
 
 	dirEntry.recursively = value["recursive"].(bool)
 	dirEntry.include_dirs = false // placeholder for future use
 
+	// load symlink policy, skip links by default
+	dirEntry.symlinks = SymlinkSkip
+	if symlinks, ok := value["symlinks"]; ok {
+		policy, err := parseSymlinkPolicy(symlinks.(string))
+		if err != nil {
+			return err
+		}
+		dirEntry.symlinks = policy
+	}
+
 	// load ignore regex if it exists
 	if ignore, ok := value["ignore"]; ok {
-		fmt.Println("Ignore regex:", ignore)
-		dirEntry.ignore_regex = regexp.MustCompile(ignore.(string))
+		logln("Ignore regex:", ignore)
+		if err := dirEntry.SetIgnore(ignore.(string)); err != nil {
+			return err
+		}
 	} else {
-		fmt.Println("No ignore regex")
+		logln("No ignore regex")
 		dirEntry.ignore_regex = nil
 	}
 
 	// load match regex if it exists
 	if match, ok := value["match"]; ok {
-		fmt.Println("Match regex:", match)
-		dirEntry.match_regex = regexp.MustCompile(match.(string))
+		logln("Match regex:", match)
+		if err := dirEntry.SetMatch(match.(string)); err != nil {
+			return err
+		}
 	} else {
-		fmt.Println("No match regex")
+		logln("No match regex")
 		dirEntry.match_regex = nil
 	}
+	return nil
+}
+
+// Value returns the config value of the dir entry, Load reads it back
+func (dirEntry *DirEntry) Value() map[string]interface{} {
+	value := map[string]interface{}{
+		"path":      dirEntry.path,
+		"recursive": dirEntry.recursively,
+	}
+	if dirEntry.symlinks != "" && dirEntry.symlinks != SymlinkSkip {
+		value["symlinks"] = string(dirEntry.symlinks)
+	}
+	if dirEntry.ignore_regex != nil {
+		value["ignore"] = dirEntry.ignore_regex.String()
+	}
+	if dirEntry.match_regex != nil {
+		value["match"] = dirEntry.match_regex.String()
+	}
+	return value
 }
 
 func (dirEntry *DirEntry) Match(path string) bool {
@@ -133,27 +407,115 @@ func (dirEntry *DirEntry) Match(path string) bool {
 	return result
 }
 
-// Parse Strategy
+// Parse Strategy, the strategy type is looked up in the registry
 func parseStrategy(key string, value map[string]interface{}) (Strategy, error) {
 	strageKey, ok := value["strategy"].(string)
 	if !ok {
 		return nil, errors.New("strategy key not found")
 	}
 
-	switch strageKey {
-	case "source_to_target_dedupe":
-		strategy := new(SourceToTargetDedupeStrategy)
-		strategy.Load(key, value)
-		return strategy, nil
-	case "pdf_mover":
-		fmt.Println("Loading pdf_mover strategy")
-		return nil, errors.New("pdf_mover strategy not implemented")
-		// strategy := new(PdfMoverStrategy)
-		// strategy.Load(value.(map[string]interface{}))
-		// config.strategies[key] = strategy
-	default:
-		return nil, errors.New("unknown strategy")
+	info, ok := LookupStrategy(strageKey)
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy: %s", strageKey)
 	}
+
+	strategy, err := info.Factory()
+	if err != nil {
+		return nil, err
+	}
+	if err := strategy.Load(key, value); err != nil {
+		return nil, err
+	}
+	return strategy, nil
+}
+
+// NewConfig creates an empty config, strategies are added with Config.AddStrategy
+func NewConfig() *Config {
+	return &Config{
+		version:    "0.1",
+		strategies: make(map[string]Strategy),
+		schedules:  make(map[string]string),
+	}
+}
+
+/*
+SetFS sets the file system Config.Execute runs the strategies on, e.g. a MemFS in tests.
+The watch and daemon modes always use the OS file system.
+*/
+func (config_struct *Config) SetFS(fsys FileSystem) {
+	config_struct.fsys = fsys
+}
+
+/*
+SetDecider sets the Decider Config.Execute asks for each duplicate group, e.g. a PromptDecider.
+The watch and daemon modes never ask.
+*/
+func (config_struct *Config) SetDecider(decider Decider) {
+	config_struct.decider = decider
+}
+
+// FS returns the file system Config.Execute runs the strategies on
+func (config_struct *Config) FS() FileSystem {
+	return fsOrDefault(config_struct.fsys)
+}
+
+// TrashRoots returns the `trash_dir` of the strategies, the trash sessions are directories below them
+func (config_struct *Config) TrashRoots() []string {
+	return config_struct.trashRootsOf(config_struct.Strategies()...)
+}
+
+// trashRootsOf returns the `trash_dir` of the named strategies
+func (config_struct *Config) trashRootsOf(names ...string) []string {
+	var roots []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		strategy, ok := config_struct.strategies[name].(*SourceToTargetDedupeStrategy)
+		if ok && !seen[strategy.trashRoot] {
+			seen[strategy.trashRoot] = true
+			roots = append(roots, strategy.trashRoot)
+		}
+	}
+	return roots
+}
+
+// AddStrategy adds a strategy under a unique name
+func (config_struct *Config) AddStrategy(name string, strategy Strategy) error {
+	if config_struct.strategies == nil {
+		config_struct.strategies = make(map[string]Strategy)
+	}
+	if _, ok := config_struct.strategies[name]; ok {
+		return fmt.Errorf("strategy already exists: %s", name)
+	}
+	if strategy == nil {
+		return errors.New("strategy is nil")
+	}
+	config_struct.strategies[name] = strategy
+	return nil
+}
+
+// SetSchedule sets the `schedule` of a strategy for RunDaemon
+func (config_struct *Config) SetSchedule(name string, spec string) error {
+	if _, ok := config_struct.strategies[name]; !ok {
+		return fmt.Errorf("strategy not found: %s", name)
+	}
+	if _, err := parseSchedule(spec); err != nil {
+		return err
+	}
+	if config_struct.schedules == nil {
+		config_struct.schedules = make(map[string]string)
+	}
+	config_struct.schedules[name] = spec
+	return nil
+}
+
+// Strategies returns the names of the strategies in the order Config.Execute runs them
+func (config_struct *Config) Strategies() []string {
+	names := make([]string, 0, len(config_struct.strategies))
+	for name := range config_struct.strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Load a configuration file
@@ -164,15 +526,16 @@ func (config_struct *Config) Load(path string) error {
 	}
 
 	config_struct.version = config["version"].(string)
-	fmt.Println("Config Version:", config_struct.version)
+	logln("Config Version:", config_struct.version)
 	if config_struct.version != "0.1" {
 		return errors.New("unsupported config version")
 	}
 	delete(config, "version")
 
 	config_struct.strategies = make(map[string]Strategy)
+	config_struct.schedules = make(map[string]string)
 	for key, jsonValue := range config {
-		fmt.Println("Found strategy entry:", key)
+		logln("Found strategy entry:", key)
 		value, ok := jsonValue.(map[string]interface{})
 		if !ok {
 			return errors.New("strategy parse error")
@@ -183,6 +546,13 @@ func (config_struct *Config) Load(path string) error {
 			return err
 		}
 		config_struct.strategies[key] = strategy
+
+		if schedule, ok := value["schedule"]; ok {
+			if _, err := parseSchedule(schedule.(string)); err != nil {
+				return fmt.Errorf("strategy %s: %w", key, err)
+			}
+			config_struct.schedules[key] = schedule.(string)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,132 @@
+package file_cleaner
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+/*
+parseSchedule parses the `schedule` of a strategy, it accepts standard cron expressions
+such as `0 3 * * *`, descriptors such as `@daily` and intervals such as `@every 1h`.
+*/
+func parseSchedule(spec string) (cron.Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+// scheduledStrategy is the next run of a strategy in daemon mode
+type scheduledStrategy struct {
+	name     string
+	schedule cron.Schedule
+	next     time.Time
+}
+
+// loadSchedules returns the scheduled strategies of the config, sorted by name
+func loadSchedules(config *Config, now time.Time) []*scheduledStrategy {
+	var scheduled []*scheduledStrategy
+	for name := range config.strategies {
+		spec, ok := config.schedules[name]
+		if !ok {
+			logln("Strategy has no schedule:", name)
+			continue
+		}
+
+		schedule, _ := parseSchedule(spec)
+		next := schedule.Next(now)
+		logln("Schedule:", name, spec, "Next run:", next.Format(time.RFC3339))
+		scheduled = append(scheduled, &scheduledStrategy{name: name, schedule: schedule, next: next})
+	}
+
+	sort.Slice(scheduled, func(i, j int) bool { return scheduled[i].name < scheduled[j].name })
+	return scheduled
+}
+
+/*
+RunDaemon runs the strategies of the config file by their `schedule` until the context is done.
+It takes the lock of the config file for its whole lifetime and the lock of the trash for each run.
+A value on reload loads the config file again, the old config is kept if the new one is invalid.
+Once the context is done, the running strategy stops after the current file operation.
+*/
+func RunDaemon(ctx context.Context, configPath string, cmdLineArgs CmdLineArgs, lock LockOptions, reload <-chan os.Signal) error {
+	unlock, err := Lock(configPath, lock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	config := new(Config)
+	if err := config.Load(configPath); err != nil {
+		return err
+	}
+
+	scheduled := loadSchedules(config, time.Now())
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		// wait for the earliest scheduled run
+		var next time.Time
+		for _, strategy := range scheduled {
+			if next.IsZero() || strategy.next.Before(next) {
+				next = strategy.next
+			}
+		}
+
+		var timerC <-chan time.Time
+		if !next.IsZero() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(next))
+			timerC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			logln("Daemon stopped")
+			return nil
+		case <-reload:
+			logln("Reloading configuration:", configPath)
+			newConfig := new(Config)
+			if err := newConfig.Load(configPath); err != nil {
+				logln("Error reloading configuration, keep the old one:", err)
+				continue
+			}
+			config = newConfig
+			scheduled = loadSchedules(config, time.Now())
+		case now := <-timerC:
+			for _, strategy := range scheduled {
+				if strategy.next.After(now) {
+					continue
+				}
+
+				// a run without a config file may use the same trash, the strategy waits for the next run then
+				if unlockTrash, err := LockTrash(config.trashRootsOf(strategy.name), lock); err != nil {
+					logln("Skip strategy, its trash is locked:", strategy.name, err)
+				} else {
+					report, err := config.ExecuteStrategy(ctx, strategy.name, cmdLineArgs)
+					unlockTrash()
+					if err != nil && ctx.Err() == nil {
+						logln("Error executing strategy:", strategy.name, err)
+					}
+					if report != nil {
+						(&Report{Strategies: []*StrategyReport{report}}).Print()
+					}
+				}
+				strategy.next = strategy.schedule.Next(time.Now())
+				logln("Next run:", strategy.name, strategy.next.Format(time.RFC3339))
+
+				// stop between strategies if the daemon is shutting down
+				if ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
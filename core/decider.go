@@ -0,0 +1,100 @@
+package file_cleaner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DuplicateGroup is a source file and the target files with the same content, in index order
+type DuplicateGroup struct {
+	Source  FileEntry
+	Keepers []FileEntry
+}
+
+/*
+Decision is the answer for a duplicate group. Keep is the index of the kept target,
+0 is the default. Skip keeps the source file and changes nothing.
+*/
+type Decision struct {
+	Keep int
+	Skip bool
+}
+
+// Decider confirms each duplicate group before the source file is moved to trash
+type Decider interface {
+	Decide(group DuplicateGroup) (Decision, error)
+}
+
+/*
+PromptDecider asks for each group on a plain terminal. An answer can be applied to all remaining groups,
+once the input ends all remaining groups are skipped.
+*/
+type PromptDecider struct {
+	input  *bufio.Scanner
+	output io.Writer
+	groups int
+
+	// all is the answer for the remaining groups, nil asks for each group
+	all *Decision
+}
+
+// NewPromptDecider reads the answers from input and writes the groups and prompts to output
+func NewPromptDecider(input io.Reader, output io.Writer) *PromptDecider {
+	return &PromptDecider{input: bufio.NewScanner(input), output: output}
+}
+
+// printEntry prints the path, size and modification time of a file of the group
+func (decider *PromptDecider) printEntry(label string, entry FileEntry, note string) {
+	fmt.Fprintf(decider.output, "  %s %s (%d bytes, %s)%s\n", label, entry.path, entry.size, entry.modTime.Format("2006-01-02 15:04:05"), note)
+}
+
+func (decider *PromptDecider) Decide(group DuplicateGroup) (Decision, error) {
+	decider.groups++
+	if decider.all != nil {
+		return *decider.all, nil
+	}
+
+	fmt.Fprintf(decider.output, "Duplicate group %d\n", decider.groups)
+	decider.printEntry("source:", group.Source, "")
+	for i, keeper := range group.Keepers {
+		note := ""
+		if i == 0 {
+			note = " kept by default"
+		}
+		decider.printEntry(fmt.Sprintf("[%d]", i+1), keeper, note)
+	}
+
+	for {
+		fmt.Fprintf(decider.output, "Enter keeps [1], 1-%d keeps another target, s skips, a keeps [1] for all, n skips all: ", len(group.Keepers))
+		if !decider.input.Scan() {
+			fmt.Fprintln(decider.output)
+			if err := decider.input.Err(); err != nil {
+				return Decision{}, err
+			}
+			decider.all = &Decision{Skip: true}
+			return *decider.all, nil
+		}
+
+		answer := strings.TrimSpace(decider.input.Text())
+		switch answer {
+		case "":
+			return Decision{}, nil
+		case "s":
+			return Decision{Skip: true}, nil
+		case "a":
+			decider.all = &Decision{}
+			return *decider.all, nil
+		case "n":
+			decider.all = &Decision{Skip: true}
+			return *decider.all, nil
+		}
+
+		if keep, err := strconv.Atoi(answer); err == nil && keep >= 1 && keep <= len(group.Keepers) {
+			return Decision{Keep: keep - 1}, nil
+		}
+		fmt.Fprintln(decider.output, "Invalid answer:", answer)
+	}
+}
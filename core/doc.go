@@ -0,0 +1,37 @@
+/*
+Package file_cleaner finds files of source directories that already exist in target directories
+and moves them to a trash directory, it is the engine of the file_cleaner command.
+
+A Config is either loaded from a JSON file with Config.Load or built in code:
+
+	target := file_cleaner.NewDirEntry("~/organized_dir", true)
+	source := file_cleaner.NewDirEntry("~/Downloads", true)
+	source.SetIgnore(`.*\.part$`)
+
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("downloads",
+		[]file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "~/trash")
+	if err != nil {
+		return err
+	}
+
+	config := file_cleaner.NewConfig()
+	config.AddStrategy("downloads", strategy)
+
+	file_cleaner.SetOutput(io.Discard)
+	report, err := config.Execute(ctx, file_cleaner.CmdLineArgs{DryRun: true})
+
+Config.Execute returns a Report with one StrategyReport per strategy, each ReportEntry is a decision
+such as a duplicate moved to trash. Progress messages are written to os.Stdout, SetOutput changes it.
+Custom strategies implement the Strategy interface and are added with Config.AddStrategy.
+
+All file access goes through a FileSystem, OSFS by default. Config.SetFS runs the strategies
+on another one, e.g. a MemFS, so they can be tested without touching the host.
+
+# Stability
+
+Starting with v1.0.0 the exported identifiers of this package follow semantic versioning:
+they are not removed or changed incompatibly within a major version. Report entries may gain
+new kinds and fields in minor versions, consumers should ignore kinds they do not know.
+The progress messages are for humans and are not part of the API.
+*/
+package file_cleaner
@@ -2,87 +2,364 @@ package file_cleaner
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
-	"fmt"
+	"crypto/sha256"
+	"hash"
 	"io"
-	"os"
+	"io/fs"
+	"sync"
+	"time"
 )
 
 type Md5Sum []byte
 
 type FileEntry struct {
-	name  string
-	path  string
-	isDir bool
-	size  int64
-	md5   Md5Sum
+	name    string
+	path    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+	md5     Md5Sum
+	sha256  []byte
+
+	// symlink information, linkTarget is only set when the entry is loaded as a link
+	isSymlink  bool
+	linkTarget string
+
+	// realPath is the path with all symlinks resolved, it is lazy loaded
+	realPath string
+
+	// device and inode number, only valid if hasID is true
+	dev   uint64
+	ino   uint64
+	hasID bool
+
+	// other names of the same inode, collapsed by ListFiles
+	hardlinks []string
+
+	// root is the DirEntry path the entry was listed from
+	root string
+
+	// fsys the entry was loaded from, nil is the OS file system
+	fsys ReadFS
 }
 
 /*
 Print prints the file entry information to the console.
 */
 func (entry *FileEntry) Print() {
-	fmt.Println("File name:", entry.name)
-	fmt.Println("File path:", entry.path)
-	fmt.Println("Is directory:", entry.isDir)
-	fmt.Println("File size:", entry.size)
+	logln("File name:", entry.name)
+	logln("File path:", entry.path)
+	logln("Is directory:", entry.isDir)
+	logln("File size:", entry.size)
+	if entry.isSymlink {
+		logln("Symlink:", entry.linkTarget)
+	}
 
 	// Lazy load MD5
 	md5, err := entry.MD5()
 	if err != nil {
-		fmt.Println("Error calculating MD5:", err)
+		logln("Error calculating MD5:", err)
 	} else {
-		fmt.Printf("MD5: %x\n", md5)
+		logf("MD5: %x\n", md5)
 	}
 }
 
 /*
 Create a new FileEntry object and load the file information from the given path.
+If the path is a symlink, the size and type are taken from the referent.
 Note: The MD5 hash is not calculated until the FileEntry.MD5() method is called.
 */
 func (entry *FileEntry) Load(path string) error {
-	fileInfo, err := os.Stat(path)
+	return entry.LoadFS(OSFS{}, path)
+}
+
+// LoadFS is FileEntry.Load() on the given file system, path is still an OS path
+func (entry *FileEntry) LoadFS(fsys ReadFS, path string) error {
+	linkInfo, err := fsys.Lstat(FSName(path))
 	if err != nil {
 		return err
 	}
 
-	entry.name = fileInfo.Name()
+	fileInfo := linkInfo
+	isSymlink := linkInfo.Mode()&fs.ModeSymlink != 0
+	if isSymlink {
+		fileInfo, err = fsys.Stat(FSName(path))
+		if err != nil {
+			return err
+		}
+	}
+
+	entry.name = linkInfo.Name()
 	entry.path = path
 	entry.isDir = fileInfo.IsDir()
 	entry.size = fileInfo.Size()
+	entry.modTime = fileInfo.ModTime()
+	entry.isSymlink = isSymlink
+	entry.linkTarget = ""
+	entry.realPath = ""
+	entry.dev, entry.ino, entry.hasID = fileID(fileInfo)
+	entry.hardlinks = nil
+	entry.fsys = fsys
 
 	// lazy load md5
 	entry.md5 = nil
+	entry.sha256 = nil
+
+	return nil
+}
+
+/*
+LoadLink loads the symlink itself instead of its referent.
+The entry keeps the link destination, the size is the size of the link.
+*/
+func (entry *FileEntry) LoadLink(path string) error {
+	return entry.LoadLinkFS(OSFS{}, path)
+}
+
+// LoadLinkFS is FileEntry.LoadLink() on the given file system
+func (entry *FileEntry) LoadLinkFS(fsys ReadFS, path string) error {
+	linkInfo, err := fsys.Lstat(FSName(path))
+	if err != nil {
+		return err
+	}
+
+	entry.name = linkInfo.Name()
+	entry.path = path
+	entry.isDir = false
+	entry.size = linkInfo.Size()
+	entry.modTime = linkInfo.ModTime()
+	entry.isSymlink = linkInfo.Mode()&fs.ModeSymlink != 0
+	entry.linkTarget = ""
+	entry.realPath = ""
+	entry.dev, entry.ino, entry.hasID = fileID(linkInfo)
+	entry.hardlinks = nil
+	entry.fsys = fsys
+	entry.md5 = nil
+	entry.sha256 = nil
+
+	if entry.isSymlink {
+		entry.linkTarget, err = fsys.ReadLink(FSName(path))
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// Name returns the file name
+func (entry *FileEntry) Name() string {
+	return entry.name
+}
+
+// Path returns the path the entry was loaded from
+func (entry *FileEntry) Path() string {
+	return entry.path
+}
+
+// Size returns the file size, for a symlink it is the size of the referent unless loaded by LoadLink
+func (entry *FileEntry) Size() int64 {
+	return entry.size
+}
+
+// ModTime returns the modification time
+func (entry *FileEntry) ModTime() time.Time {
+	return entry.modTime
+}
+
+// IsDir returns true if the entry is a directory
+func (entry *FileEntry) IsDir() bool {
+	return entry.isDir
+}
+
+/*
+Root returns the path of the DirEntry the entry was listed from,
+it is empty if the entry was not created by ListFiles.
+*/
+func (entry *FileEntry) Root() string {
+	return entry.root
+}
+
+// fs returns the file system of the entry
+func (entry *FileEntry) fs() ReadFS {
+	if entry.fsys == nil {
+		return OSFS{}
+	}
+	return entry.fsys
+}
+
+/*
+IsSymlink returns true if the entry path is a symbolic link.
+*/
+func (entry *FileEntry) IsSymlink() bool {
+	return entry.isSymlink
+}
+
+/*
+RealPath returns the absolute path with all symlinks resolved.
+The result is cached after the first call to this method.
+*/
+func (entry *FileEntry) RealPath() (string, error) {
+	if entry.realPath != "" {
+		return entry.realPath, nil
+	}
+
+	realPath, err := evalSymlinks(entry.fs(), entry.path)
+	if err != nil {
+		return "", err
+	}
+
+	entry.realPath = realPath
+	return entry.realPath, nil
+}
+
+/*
+unchanged returns true if the file still has the size, modification time and inode it was loaded with.
+The inode is only checked if the file system reports it.
+*/
+func (entry *FileEntry) unchanged(fsys ReadFS) bool {
+	var current FileEntry
+	if err := current.LoadFS(fsys, entry.path); err != nil {
+		return false
+	}
+	if current.size != entry.size || !current.modTime.Equal(entry.modTime) {
+		return false
+	}
+	if entry.hasID && current.hasID && (current.dev != entry.dev || current.ino != entry.ino) {
+		return false
+	}
+	return true
+}
+
+// inodeKey identifies an inode, the names of one inode share it
+type inodeKey struct{ dev, ino uint64 }
+
+// inode returns the inode of the entry, nil if the platform does not report inodes
+func (entry *FileEntry) inode() *inodeKey {
+	if !entry.hasID {
+		return nil
+	}
+	return &inodeKey{entry.dev, entry.ino}
+}
+
+/*
+SameInode returns true if both entries are names of the same inode on the same device,
+for example two hardlinks. It returns false if the platform does not report inodes.
+*/
+func (entry *FileEntry) SameInode(other *FileEntry) bool {
+	if !entry.hasID || !other.hasID {
+		return false
+	}
+	return entry.dev == other.dev && entry.ino == other.ino
+}
+
+/*
+Hardlinks returns the other names of the same inode that ListFiles collapsed into this entry.
+*/
+func (entry *FileEntry) Hardlinks() []string {
+	return entry.hardlinks
+}
+
+/*
+SameFile returns true if both entries resolve to the same file, for example
+a symlink and its referent or two hardlinks. These are never two copies of the same content.
+*/
+func (entry *FileEntry) SameFile(other *FileEntry) bool {
+	if entry.SameInode(other) {
+		return true
+	}
+
+	realPath, err := entry.RealPath()
+	if err != nil {
+		return false
+	}
+
+	otherRealPath, err := other.RealPath()
+	if err != nil {
+		return false
+	}
+
+	return realPath == otherRealPath
+}
+
 /*
 MD5 calculates the MD5 hash of the file and returns it as a byte slice.
 The MD5 hash is cached after the first call to this method.
 */
 func (entry *FileEntry) MD5() (Md5Sum, error) {
+	return entry.MD5Context(context.Background())
+}
+
+/*
+MD5Context is FileEntry.MD5() that stops hashing once the context is done.
+*/
+func (entry *FileEntry) MD5Context(ctx context.Context) (Md5Sum, error) {
 	if entry.md5 != nil {
 		return entry.md5, nil
 	}
 
-	file, err := os.Open(entry.path)
+	sum, err := entry.hashFile(ctx, md5.New())
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	entry.md5 = sum
+	return entry.md5, nil
+}
+
+/*
+SHA256 calculates the SHA-256 hash of the file, it is cached like FileEntry.MD5().
+It stops hashing once the context is done.
+*/
+func (entry *FileEntry) SHA256(ctx context.Context) ([]byte, error) {
+	if entry.sha256 != nil {
+		return entry.sha256, nil
+	}
+
+	sum, err := entry.hashFile(ctx, sha256.New())
+	if err != nil {
+		return nil, err
+	}
+	entry.sha256 = sum
+	return entry.sha256, nil
+}
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
+// hashFile reads the whole file into the hash
+func (entry *FileEntry) hashFile(ctx context.Context, hash hash.Hash) ([]byte, error) {
+	file, err := entry.fs().Open(FSName(entry.path))
+	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	entry.md5 = hash.Sum(nil)
-	return entry.md5, nil
+	buffer := compareBuffers.Get().(*[]byte)
+	defer compareBuffers.Put(buffer)
+
+	size, err := io.CopyBuffer(hash, &contextReader{ctx: ctx, reader: file}, *buffer)
+	if counter, ok := entry.fs().(*hashingFS); ok {
+		counter.addHashed(size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
 }
 
-// compareBufferSize is the size of the buffer used to compare file contents.
-const compareBufferSize = 1024
+// compareBufferSize is the size of the blocks read from each file.
+const compareBufferSize = 256 * 1024
+
+// compareBuffers are reused by all comparisons, a buffer is a *[]byte of compareBufferSize
+var compareBuffers = sync.Pool{New: func() any {
+	buffer := make([]byte, compareBufferSize)
+	return &buffer
+}}
+
+// CompareOptions changes how FileEntry.CompareWith() decides two files are equal
+type CompareOptions struct {
+	// TrustHash decides by the SHA-256 hash alone, the content is not compared a second time
+	TrustHash bool
+}
 
 /*
 Compare compares the two file is the same or not.
@@ -90,56 +367,113 @@ it would compare the size and md5 first.
 then compare the content of the file.
 */
 func (entry *FileEntry) Compare(other *FileEntry) bool {
+	equal, _ := entry.CompareContext(context.Background(), other)
+	return equal
+}
+
+/*
+CompareContext is FileEntry.Compare() that stops once the context is done,
+the error is only set if the context is done.
+*/
+func (entry *FileEntry) CompareContext(ctx context.Context, other *FileEntry) (bool, error) {
+	return entry.CompareWith(ctx, other, CompareOptions{})
+}
+
+/*
+CompareWith is FileEntry.CompareContext() with options. The size is compared first,
+then the cached hash, then the content. With TrustHash a matching SHA-256 is enough.
+*/
+func (entry *FileEntry) CompareWith(ctx context.Context, other *FileEntry, options CompareOptions) (bool, error) {
 	if entry.size != other.size {
-		return false
+		return false, nil
 	}
 
-	// check md5
-	md5, err := entry.MD5()
+	if options.TrustHash {
+		sum, err := entry.SHA256(ctx)
+		if err != nil {
+			return false, ctx.Err()
+		}
+		otherSum, err := other.SHA256(ctx)
+		if err != nil {
+			return false, ctx.Err()
+		}
+		return bytes.Equal(sum, otherSum), nil
+	}
+
+	// the md5 is cached, it rules out most files compared with many others
+	md5, err := entry.MD5Context(ctx)
 	if err != nil {
-		return false
+		return false, ctx.Err()
 	}
 
-	otherMd5, err := other.MD5()
+	otherMd5, err := other.MD5Context(ctx)
 	if err != nil {
-		return false
+		return false, ctx.Err()
 	}
 
-	if fmt.Sprintf("%x", md5) != fmt.Sprintf("%x", otherMd5) {
-		return false
+	if !bytes.Equal(md5, otherMd5) {
+		return false, nil
 	}
 
-	// open file and compare the content
-	file1, err := os.Open(entry.path)
-	file2, err2 := os.Open(other.path)
-	if err != nil || err2 != nil {
-		return false
+	return entry.compareContent(ctx, other)
+}
+
+// readResult is the result of reading one block
+type readResult struct {
+	size int
+	err  error
+}
+
+/*
+compareContent compares the files block by block, the blocks of both files are read in parallel.
+A file that can not be read is not equal, the error is only set if the context is done.
+*/
+func (entry *FileEntry) compareContent(ctx context.Context, other *FileEntry) (bool, error) {
+	file1, err := entry.fs().Open(FSName(entry.path))
+	if err != nil {
+		return false, nil
 	}
 	defer file1.Close()
+
+	file2, err := other.fs().Open(FSName(other.path))
+	if err != nil {
+		return false, nil
+	}
 	defer file2.Close()
 
-	for {
-		block1 := make([]byte, compareBufferSize)
-		size1, err1 := file1.Read(block1)
-		block2 := make([]byte, compareBufferSize)
-		size2, err2 := file2.Read(block2)
+	buffer1 := compareBuffers.Get().(*[]byte)
+	defer compareBuffers.Put(buffer1)
+	buffer2 := compareBuffers.Get().(*[]byte)
+	defer compareBuffers.Put(buffer2)
 
-		// check if it is the end of the file
-		if err1 == io.EOF && err2 == io.EOF {
-			return true
+	read2 := make(chan readResult, 1)
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
 		}
 
-		if err1 != nil || err2 != nil {
-			return false
-		}
+		go func() {
+			size, err := io.ReadFull(file2, *buffer2)
+			read2 <- readResult{size, err}
+		}()
+		size1, err1 := io.ReadFull(file1, *buffer1)
+		result2 := <-read2
 
-		if size1 != size2 {
-			return false
+		// io.ReadFull only returns a short block at the end of the file
+		end1 := err1 == io.EOF || err1 == io.ErrUnexpectedEOF
+		end2 := result2.err == io.EOF || result2.err == io.ErrUnexpectedEOF
+		if (err1 != nil && !end1) || (result2.err != nil && !end2) {
+			return false, nil
 		}
 
 		// check block content is the same
-		if !bytes.Equal(block1, block2) {
-			return false
+		if size1 != result2.size || !bytes.Equal((*buffer1)[:size1], (*buffer2)[:size1]) {
+			return false, nil
+		}
+
+		// check if it is the end of the file
+		if end1 || end2 {
+			return end1 == end2, nil
 		}
 	}
 }
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package file_cleaner
+
+import "os"
+
+// fileID is not supported on this platform, hardlinks are not detected
+func fileID(info os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package file_cleaner
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode number of the file
+func fileID(info os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), true
+}
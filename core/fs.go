@@ -0,0 +1,176 @@
+package file_cleaner
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ReadFS is the read side of the file system used by the package.
+It is an fs.FS with symlink support, names are slash separated and unrooted as in io/fs,
+FSName converts an OS path to a name. Stat and Open follow symlinks, Lstat does not.
+*/
+type ReadFS interface {
+	fs.StatFS
+	Lstat(name string) (fs.FileInfo, error)
+	ReadLink(name string) (string, error)
+}
+
+// WritableFile is a file opened by WriteFS.OpenFile
+type WritableFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+/*
+WriteFS is the write side used by the strategies to move files and create links.
+Names are converted with FSName like ReadFS, the oldname of Symlink is the link content as is.
+*/
+type WriteFS interface {
+	MkdirAll(name string, perm fs.FileMode) error
+	Rename(oldname string, newname string) error
+	Symlink(oldname string, newname string) error
+	Remove(name string) error
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+}
+
+// FileSystem is everything the strategies need, OSFS and MemFS implement it
+type FileSystem interface {
+	ReadFS
+	WriteFS
+}
+
+// maxSymlinks limits the number of symlinks resolved for one path
+const maxSymlinks = 255
+
+/*
+FSName converts an OS path to a ReadFS name, relative paths are resolved from the working directory.
+*/
+func FSName(osPath string) string {
+	absPath, err := filepath.Abs(osPath)
+	if err != nil {
+		absPath = filepath.Clean(osPath)
+	}
+	absPath = filepath.ToSlash(strings.TrimPrefix(absPath, filepath.VolumeName(absPath)))
+	name := strings.TrimPrefix(absPath, "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// osPath converts a ReadFS name back to an absolute OS path
+func osPath(name string) string {
+	if name == "." {
+		return string(filepath.Separator)
+	}
+	return filepath.FromSlash("/" + name)
+}
+
+/*
+evalSymlinks is filepath.EvalSymlinks on a ReadFS, it returns the absolute OS path with all links resolved.
+*/
+func evalSymlinks(fsys ReadFS, osPath_ string) (string, error) {
+	resolved := "."
+	rest := strings.Split(FSName(osPath_), "/")
+	hops := 0
+
+	for len(rest) > 0 {
+		part := rest[0]
+		rest = rest[1:]
+		if part == "" || part == "." {
+			continue
+		}
+
+		if part == ".." {
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+
+		info, err := fsys.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		hops++
+		if hops > maxSymlinks {
+			return "", errors.New("too many links: " + osPath_)
+		}
+
+		link, err := fsys.ReadLink(next)
+		if err != nil {
+			return "", err
+		}
+
+		// the remaining parts are resolved below the link destination
+		link = filepath.ToSlash(link)
+		if strings.HasPrefix(link, "/") {
+			resolved = "."
+		}
+		rest = append(strings.Split(link, "/"), rest...)
+	}
+	return osPath(resolved), nil
+}
+
+// OSFS is the FileSystem of the operating system, it is used if no other FileSystem is set
+type OSFS struct{}
+
+func (OSFS) Open(name string) (fs.File, error) {
+	return os.Open(osPath(name))
+}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(osPath(name))
+}
+
+func (OSFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(osPath(name))
+}
+
+func (OSFS) ReadLink(name string) (string, error) {
+	return os.Readlink(osPath(name))
+}
+
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(osPath(name))
+}
+
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(osPath(name), perm)
+}
+
+func (OSFS) Rename(oldname string, newname string) error {
+	return os.Rename(osPath(oldname), osPath(newname))
+}
+
+func (OSFS) Symlink(oldname string, newname string) error {
+	return os.Symlink(oldname, osPath(newname))
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(osPath(name))
+}
+
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	return os.OpenFile(osPath(name), flag, perm)
+}
+
+// fsOrDefault returns fsys, or OSFS if it is nil
+func fsOrDefault(fsys FileSystem) FileSystem {
+	if fsys == nil {
+		return OSFS{}
+	}
+	return fsys
+}
@@ -0,0 +1,194 @@
+package file_cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IngestLayout is a preset destination template of the ingest option
+type IngestLayout string
+
+const (
+	// IngestByExtension places files in a directory named after the extension, e.g. `pdf/paper.pdf`
+	IngestByExtension IngestLayout = "extension"
+	// IngestByDate places files by modification time, e.g. `2024/05/paper.pdf`
+	IngestByDate IngestLayout = "date"
+	// IngestMirror keeps the path relative to the source directory
+	IngestMirror IngestLayout = "mirror"
+)
+
+// ingestLayouts maps each layout to its template
+var ingestLayouts = map[IngestLayout]string{
+	IngestByExtension: "{ext}/{name}",
+	IngestByDate:      "{year}/{month}/{name}",
+	IngestMirror:      "{dir}/{name}",
+}
+
+// noExtensionDir is the `{ext}` value of files without extension
+const noExtensionDir = "no_extension"
+
+/*
+IngestConfig moves the unique source files into the target tree,
+it is the `ingest` option of `source_to_target_dedupe`.
+*/
+type IngestConfig struct {
+	mover *Mover
+	rule  string
+}
+
+/*
+Load the ingest option, the default directory is the first target.
+`template` overrides the template of `layout`.
+*/
+func (ingest *IngestConfig) Load(name string, value map[string]interface{}, targets []DirEntry) error {
+	layout := IngestByExtension
+	if value, ok := value["layout"]; ok {
+		layout = IngestLayout(value.(string))
+	}
+	template, ok := ingestLayouts[layout]
+	if !ok {
+		return fmt.Errorf("unknown ingest layout: %s", layout)
+	}
+	if value, ok := value["template"]; ok {
+		template = value.(string)
+	}
+
+	var dir string
+	if value, ok := value["dir"]; ok {
+		dir = expandDir(value.(string))
+	} else if len(targets) > 0 {
+		dir = targets[0].path
+	} else {
+		return errors.New("ingest dir not found")
+	}
+
+	collision := CollisionSkip
+	if value, ok := value["collision"]; ok {
+		collision = CollisionPolicy(value.(string))
+	}
+
+	mover, err := NewMover(dir, template, collision)
+	if err != nil {
+		return err
+	}
+	ingest.mover = mover
+	ingest.rule = name
+
+	logln("Ingest Dir:", dir, "Template:", template, "Collision:", collision)
+	return nil
+}
+
+/*
+Destination returns the path the entry would be moved to before collisions are resolved,
+source is the DirEntry the entry was listed from.
+*/
+func (ingest *IngestConfig) Destination(entry *FileEntry, source DirEntry) (string, error) {
+	rel, err := filepath.Rel(source.path, filepath.Dir(entry.path))
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not below %s", entry.path, source.path)
+	}
+
+	return ingest.mover.Destination(entry, TemplateFields{Rule: ingest.rule, Dir: rel})
+}
+
+/*
+moveFile moves the file and creates the parent directories,
+it never overwrites an existing file.
+*/
+func moveFile(fsys FileSystem, from string, to string) error {
+	if _, err := fsys.Lstat(FSName(to)); err == nil {
+		return fmt.Errorf("destination already exists: %s", to)
+	}
+
+	if err := fsys.MkdirAll(FSName(filepath.Dir(to)), os.ModePerm); err != nil {
+		return err
+	}
+	return fsys.Rename(FSName(from), FSName(to))
+}
+
+/*
+ingestHandler moves a unique source file into the ingest directory.
+It returns the entry as it is indexed after the move, ok is false if the file was not moved.
+planned records the destinations of this run, so a dry run detects collisions between source files.
+The error is only set if the context is done.
+*/
+func ingestHandler(ctx context.Context, entry FileEntry, source DirEntry, parms ExecuteArgs, strategy SourceToTargetDedupeStrategy, planned map[string]bool) (moved FileEntry, ok bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return entry, false, err
+	}
+
+	destination, err := strategy.ingest.Destination(&entry, source)
+	if err != nil {
+		logln("  Skip ingest:", entry.path, err)
+		return entry, false, nil
+	}
+
+	final, existing, ok := strategy.ingest.mover.resolve(&entry, destination, func(path string) bool { return planned[path] })
+	if !ok {
+		logln("  Collision:", entry.path)
+		logln("    Destination:", destination)
+		parms.Report.add(ReportEntry{Kind: ReportCollision, Path: entry.path, Size: entry.size, Destination: destination})
+		return entry, false, nil
+	}
+
+	logln("  Ingest:", entry.path)
+	logln("    Destination:", final)
+
+	// the identical file at the destination is replaced, it is kept in trash
+	replace := existing != nil
+	trashPath := ""
+	if replace {
+		trashPath = trashPathFor(strategy.trashPath, final)
+		logln("    Replacing identical file, Trash Path:", trashPath)
+
+		// the identical file may have been edited since it was compared
+		if !parms.Cmd.DryRun && !existing.unchanged(parms.fs()) {
+			logln("    Changed since scan, skipped:", entry.path)
+			parms.Report.add(ReportEntry{Kind: ReportChanged, Path: entry.path, Keep: final, Size: entry.size, Destination: final})
+			return entry, false, nil
+		}
+	}
+
+	// the same actions are run by a real run and listed by a dry run
+	actions := ingestActions(entry.path, final, trashPath)
+	if !parms.Cmd.DryRun {
+		if replace {
+			if err := moveFile(parms.fs(), final, trashPath); err != nil {
+				logln("    Error moving file to trash:", err)
+				return entry, false, nil
+			}
+			parms.Report.addActions(actions[:2]...)
+			if err := parms.Manifest.Record(ManifestTrash, final, trashPath); err != nil {
+				logln("    Error writing manifest:", err)
+			}
+		}
+		if err := moveFile(parms.fs(), entry.path, final); err != nil {
+			logln("    Error moving file:", err)
+			return entry, false, nil
+		}
+		parms.Report.addActions(actions[len(actions)-2:]...)
+		if err := parms.Manifest.Record(ManifestMove, entry.path, final); err != nil {
+			logln("    Error writing manifest:", err)
+		}
+	} else {
+		logln("    Dry Run: Not moving file")
+		parms.Report.addActions(actions...)
+	}
+	planned[final] = true
+	parms.Report.add(ReportEntry{Kind: ReportIngest, Path: entry.path, Size: entry.size, Destination: final, TrashPath: trashPath})
+
+	if !parms.Cmd.DryRun {
+		entry.path = final
+		entry.name = filepath.Base(final)
+		entry.realPath = ""
+	}
+	entry.root = strategy.ingest.mover.Root()
+	return entry, true, nil
+}
@@ -0,0 +1,194 @@
+package file_cleaner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// lockRetryDelay is the interval between lock attempts while waiting
+const lockRetryDelay = 200 * time.Millisecond
+
+// ErrLocked is returned by Lock if another instance holds the lock
+var ErrLocked = errors.New("another instance of file_cleaner is already running")
+
+// LockOptions decide where the lock file is stored and how long to wait for it
+type LockOptions struct {
+	// Dir is the directory of the lock files, DefaultLockDir() if empty
+	Dir string
+	// Wait is the maximum time to wait for the lock, zero fails at once
+	Wait time.Duration
+}
+
+// LockInfo is written to the lock file by the instance holding it
+type LockInfo struct {
+	PID       int       `json:"pid"`
+	StartTime time.Time `json:"start_time"`
+	Config    string    `json:"config"`
+	// Trash is the trash root of a lock taken by LockTrash, Config is empty then
+	Trash string `json:"trash,omitempty"`
+}
+
+// LockState is the state of a lock file reported by LockStatus
+type LockState struct {
+	Path string
+	Held bool
+	// Info is only set if the lock is held
+	Info *LockInfo
+}
+
+// DefaultLockDir returns XDG_RUNTIME_DIR if it is set, otherwise the temp directory
+func DefaultLockDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+/*
+LockPathFor returns the lock file of the config file,
+two different config files never share a lock.
+*/
+func LockPathFor(dir string, configPath string) (string, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", err
+	}
+	return lockPath(dir, absPath), nil
+}
+
+// lockPath returns the lock file of the absolute path of a config file or trash root
+func lockPath(dir string, absPath string) string {
+	if dir == "" {
+		dir = DefaultLockDir()
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(dir, fmt.Sprintf("file_cleaner-%x.lock", sum[:6]))
+}
+
+/*
+Lock takes the lock of the config file, it waits up to options.Wait if another instance holds it.
+The lock file records the PID and start time, the returned function releases the lock.
+*/
+func Lock(configPath string, options LockOptions) (unlock func(), err error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return lockFile(lockPath(options.Dir, absPath), LockInfo{Config: absPath}, options)
+}
+
+/*
+LockTrash takes the lock of each trash root, so runs with and without a config file
+that move files to the same trash exclude each other. All locks are released if one is held.
+*/
+func LockTrash(trashRoots []string, options LockOptions) (unlock func(), err error) {
+	var unlocks []func()
+	unlock = func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+
+	// the roots are locked in the same order by every instance
+	roots := make([]string, 0, len(trashRoots))
+	for _, root := range trashRoots {
+		absPath, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, absPath)
+	}
+	sort.Strings(roots)
+
+	for i, root := range roots {
+		if i > 0 && roots[i-1] == root {
+			continue
+		}
+		rootUnlock, err := lockFile(lockPath(options.Dir, root), LockInfo{Trash: root}, options)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		unlocks = append(unlocks, rootUnlock)
+	}
+	return unlock, nil
+}
+
+// lockFile takes the lock file at path and writes info with the PID and start time to it
+func lockFile(path string, info LockInfo, options LockOptions) (unlock func(), err error) {
+	lockFile := flock.New(path)
+	var locked bool
+	if options.Wait > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), options.Wait)
+		defer cancel()
+		locked, err = lockFile.TryLockContext(ctx, lockRetryDelay)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = nil
+		}
+	} else {
+		locked, err = lockFile.TryLock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrLocked
+	}
+
+	info.PID = os.Getpid()
+	info.StartTime = time.Now()
+	data, _ := json.Marshal(info)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		lockFile.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		os.Truncate(path, 0)
+		lockFile.Unlock()
+	}, nil
+}
+
+/*
+LockStatus reports the lock files in dir and who holds them.
+It only reads the PID recorded in each lock file and never takes a lock,
+so it does not get in the way of an instance that is starting.
+*/
+func LockStatus(dir string) ([]LockState, error) {
+	if dir == "" {
+		dir = DefaultLockDir()
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "file_cleaner-*.lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	var states []LockState
+	for _, path := range paths {
+		state := LockState{Path: path}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// the lock file is truncated on unlock, a PID left by a crashed instance is not running
+		info := new(LockInfo)
+		if strings.TrimSpace(string(content)) != "" && json.Unmarshal(content, info) == nil && processRunning(info.PID) {
+			state.Held = true
+			state.Info = info
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package file_cleaner
+
+import "os"
+
+// processRunning returns true if a process with the pid exists
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package file_cleaner
+
+import "syscall"
+
+// processRunning returns true if a process with the pid exists
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,117 @@
+package file_cleaner
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestName is the file name of the manifest inside a trash session
+const ManifestName = "manifest.jsonl"
+
+const (
+	// ManifestTrash moved a file into the trash
+	ManifestTrash = "trash"
+	// ManifestSymlink created a symlink in place of a trashed file
+	ManifestSymlink = "symlink"
+	// ManifestMove moved a file out of the source, e.g. by ingest
+	ManifestMove = "move"
+)
+
+// ManifestRecord is one finished file operation, stored as a JSON line
+type ManifestRecord struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+}
+
+/*
+Manifest records every file operation of a trash session, so an interrupted run
+still tells what was moved where. Each record is synced to disk before the next operation.
+The file is only created by the first record, a dry run never creates it.
+*/
+type Manifest struct {
+	path string
+	fsys WriteFS
+	file WritableFile
+}
+
+// NewManifest creates the manifest of the trash session
+func NewManifest(trashPath string) *Manifest {
+	return NewManifestFS(OSFS{}, trashPath)
+}
+
+// NewManifestFS creates the manifest of the trash session on the given file system
+func NewManifestFS(fsys WriteFS, trashPath string) *Manifest {
+	return &Manifest{path: filepath.Join(trashPath, ManifestName), fsys: fsys}
+}
+
+// Path returns the path of the manifest file
+func (manifest *Manifest) Path() string {
+	return manifest.path
+}
+
+// Record appends a finished operation and flushes it to disk
+func (manifest *Manifest) Record(action string, from string, to string) error {
+	if manifest == nil {
+		return nil
+	}
+
+	if manifest.file == nil {
+		if err := manifest.fsys.MkdirAll(FSName(filepath.Dir(manifest.path)), os.ModePerm); err != nil {
+			return err
+		}
+		file, err := manifest.fsys.OpenFile(FSName(manifest.path), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		manifest.file = file
+	}
+
+	line, err := json.Marshal(ManifestRecord{Time: time.Now(), Action: action, From: from, To: to})
+	if err != nil {
+		return err
+	}
+	if _, err := manifest.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return manifest.file.Sync()
+}
+
+// Close closes the manifest file
+func (manifest *Manifest) Close() error {
+	if manifest == nil || manifest.file == nil {
+		return nil
+	}
+	err := manifest.file.Close()
+	manifest.file = nil
+	return err
+}
+
+// ReadManifest reads all records of a manifest file
+func ReadManifest(path string) ([]ManifestRecord, error) {
+	return ReadManifestFS(OSFS{}, path)
+}
+
+// ReadManifestFS reads all records of a manifest file on the given file system
+func ReadManifestFS(fsys ReadFS, path string) ([]ManifestRecord, error) {
+	file, err := fsys.Open(FSName(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []ManifestRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record ManifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
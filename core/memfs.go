@@ -0,0 +1,463 @@
+package file_cleaner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// memNode is a file, directory or symlink of a MemFS
+type memNode struct {
+	mode    fs.FileMode
+	data    []byte
+	link    string
+	modTime time.Time
+}
+
+/*
+MemFS is an in-memory FileSystem, strategies run on it never touch the host.
+Names are ReadFS names, the root directory always exists. Hardlinks are not supported,
+the entries of a MemFS never report an inode. It is safe for concurrent use.
+*/
+type MemFS struct {
+	mutex sync.Mutex
+	nodes map[string]*memNode
+}
+
+// NewMemFS creates an empty MemFS
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: map[string]*memNode{
+		".": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+	}}
+}
+
+// memInfo is the fs.FileInfo of a memNode
+type memInfo struct {
+	name string
+	node memNode
+}
+
+func (info memInfo) Name() string       { return info.name }
+func (info memInfo) Size() int64        { return int64(len(info.node.data)) }
+func (info memInfo) Mode() fs.FileMode  { return info.node.mode }
+func (info memInfo) ModTime() time.Time { return info.node.modTime }
+func (info memInfo) IsDir() bool        { return info.node.mode.IsDir() }
+func (info memInfo) Sys() any           { return nil }
+
+// newInfo copies the node, so the info does not change with the file
+func newInfo(name string, node *memNode) memInfo {
+	if name == "." {
+		name = "/"
+	}
+	info := memInfo{name: path.Base(name), node: *node}
+	if info.node.mode&fs.ModeSymlink != 0 {
+		info.node.data = make([]byte, len(node.link))
+	}
+	return info
+}
+
+func pathError(op string, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+/*
+resolve returns the name with all symlinks of the parents resolved, and the last element
+if followLast is set. The returned name may not exist. The mutex must be held.
+*/
+func (memfs *MemFS) resolve(op string, name string, followLast bool) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", pathError(op, name, fs.ErrInvalid)
+	}
+
+	resolved := "."
+	rest := strings.Split(name, "/")
+	hops := 0
+	for len(rest) > 0 {
+		part := rest[0]
+		rest = rest[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		node, ok := memfs.nodes[next]
+		if !ok {
+			// nothing below a missing element exists
+			if len(rest) > 0 {
+				return "", pathError(op, name, fs.ErrNotExist)
+			}
+			return next, nil
+		}
+
+		if node.mode&fs.ModeSymlink != 0 && (len(rest) > 0 || followLast) {
+			hops++
+			if hops > maxSymlinks {
+				return "", pathError(op, name, errors.New("too many links"))
+			}
+			if strings.HasPrefix(node.link, "/") {
+				resolved = "."
+			}
+			rest = append(strings.Split(node.link, "/"), rest...)
+			continue
+		}
+
+		if len(rest) > 0 && !node.mode.IsDir() {
+			return "", pathError(op, name, syscall.ENOTDIR)
+		}
+		resolved = next
+	}
+	return resolved, nil
+}
+
+// lookup resolves the name and returns its node, the mutex must be held
+func (memfs *MemFS) lookup(op string, name string, followLast bool) (string, *memNode, error) {
+	resolved, err := memfs.resolve(op, name, followLast)
+	if err != nil {
+		return "", nil, err
+	}
+	node, ok := memfs.nodes[resolved]
+	if !ok {
+		return "", nil, pathError(op, name, fs.ErrNotExist)
+	}
+	return resolved, node, nil
+}
+
+// parentDir checks that the parent of the resolved name is a directory, the mutex must be held
+func (memfs *MemFS) parentDir(op string, name string, resolved string) error {
+	parent, ok := memfs.nodes[path.Dir(resolved)]
+	if !ok {
+		return pathError(op, name, fs.ErrNotExist)
+	}
+	if !parent.mode.IsDir() {
+		return pathError(op, name, syscall.ENOTDIR)
+	}
+	return nil
+}
+
+// children returns the sorted entries of the directory, the mutex must be held
+func (memfs *MemFS) children(dir string) []fs.DirEntry {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+
+	var entries []fs.DirEntry
+	for name, node := range memfs.nodes {
+		if name == "." || !strings.HasPrefix(name, prefix) || strings.Contains(name[len(prefix):], "/") {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(newInfo(name, node)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+func (memfs *MemFS) Open(name string) (fs.File, error) {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	resolved, node, err := memfs.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &memFile{info: newInfo(name, node)}
+	if node.mode.IsDir() {
+		file.entries = memfs.children(resolved)
+	} else {
+		file.reader = bytes.NewReader(node.data)
+	}
+	return file, nil
+}
+
+func (memfs *MemFS) Stat(name string) (fs.FileInfo, error) {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	_, node, err := memfs.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return newInfo(name, node), nil
+}
+
+func (memfs *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	_, node, err := memfs.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return newInfo(name, node), nil
+}
+
+func (memfs *MemFS) ReadLink(name string) (string, error) {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	_, node, err := memfs.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", pathError("readlink", name, fs.ErrInvalid)
+	}
+	return node.link, nil
+}
+
+func (memfs *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	resolved, node, err := memfs.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, pathError("readdir", name, syscall.ENOTDIR)
+	}
+	return memfs.children(resolved), nil
+}
+
+func (memfs *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	if !fs.ValidPath(name) {
+		return pathError("mkdir", name, fs.ErrInvalid)
+	}
+
+	// create the elements one by one, so symlinked parents are followed
+	current := "."
+	for _, part := range strings.Split(name, "/") {
+		if part == "." {
+			continue
+		}
+		current = path.Join(current, part)
+		resolved, err := memfs.resolve("mkdir", current, true)
+		if err != nil {
+			return err
+		}
+
+		node, ok := memfs.nodes[resolved]
+		if !ok {
+			memfs.nodes[resolved] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+		} else if !node.mode.IsDir() {
+			return pathError("mkdir", name, syscall.ENOTDIR)
+		}
+	}
+	return nil
+}
+
+func (memfs *MemFS) Rename(oldname string, newname string) error {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	from, node, err := memfs.lookup("rename", oldname, false)
+	if err != nil {
+		return err
+	}
+	to, err := memfs.resolve("rename", newname, false)
+	if err != nil {
+		return err
+	}
+	if err := memfs.parentDir("rename", newname, to); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if strings.HasPrefix(to, from+"/") {
+		return pathError("rename", newname, fs.ErrInvalid)
+	}
+
+	// like rename(2) an existing file is replaced, an existing directory only if it is empty
+	if existing, ok := memfs.nodes[to]; ok {
+		if existing.mode.IsDir() != node.mode.IsDir() || len(memfs.children(to)) > 0 {
+			return pathError("rename", newname, fs.ErrExist)
+		}
+	}
+
+	memfs.nodes[to] = node
+	delete(memfs.nodes, from)
+	if node.mode.IsDir() {
+		for name, child := range memfs.nodes {
+			if strings.HasPrefix(name, from+"/") {
+				memfs.nodes[to+name[len(from):]] = child
+				delete(memfs.nodes, name)
+			}
+		}
+	}
+	return nil
+}
+
+func (memfs *MemFS) Symlink(oldname string, newname string) error {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	resolved, err := memfs.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if err := memfs.parentDir("symlink", newname, resolved); err != nil {
+		return err
+	}
+	if _, ok := memfs.nodes[resolved]; ok {
+		return pathError("symlink", newname, fs.ErrExist)
+	}
+
+	memfs.nodes[resolved] = &memNode{mode: fs.ModeSymlink | 0777, link: oldname, modTime: time.Now()}
+	return nil
+}
+
+func (memfs *MemFS) Remove(name string) error {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	resolved, node, err := memfs.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if resolved == "." || (node.mode.IsDir() && len(memfs.children(resolved)) > 0) {
+		return pathError("remove", name, syscall.ENOTEMPTY)
+	}
+	delete(memfs.nodes, resolved)
+	return nil
+}
+
+/*
+OpenFile opens a file for writing, os.O_CREATE, os.O_EXCL, os.O_TRUNC and os.O_APPEND are supported.
+Writes always append, a MemFS file has no write offset.
+*/
+func (memfs *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	resolved, err := memfs.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	node, ok := memfs.nodes[resolved]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, fs.ErrExist)
+	case ok && node.mode.IsDir():
+		return nil, pathError("open", name, syscall.EISDIR)
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, pathError("open", name, fs.ErrNotExist)
+	case !ok:
+		if err := memfs.parentDir("open", name, resolved); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		memfs.nodes[resolved] = node
+	}
+
+	if flag&os.O_TRUNC != 0 {
+		node.data = nil
+	}
+	return &memWriter{memfs: memfs, node: node}, nil
+}
+
+// WriteFile writes the file like os.WriteFile, the parent directory must exist
+func (memfs *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	file, err := memfs.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Chtimes sets the modification time of the file, symlinks are followed
+func (memfs *MemFS) Chtimes(name string, modTime time.Time) error {
+	memfs.mutex.Lock()
+	defer memfs.mutex.Unlock()
+
+	_, node, err := memfs.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	node.modTime = modTime
+	return nil
+}
+
+// memFile is a MemFS file opened for reading
+type memFile struct {
+	info    memInfo
+	reader  *bytes.Reader
+	entries []fs.DirEntry
+}
+
+func (file *memFile) Stat() (fs.FileInfo, error) {
+	return file.info, nil
+}
+
+func (file *memFile) Read(buffer []byte) (int, error) {
+	if file.reader == nil {
+		return 0, pathError("read", file.info.name, syscall.EISDIR)
+	}
+	return file.reader.Read(buffer)
+}
+
+func (file *memFile) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile
+func (file *memFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if file.reader != nil {
+		return nil, pathError("readdir", file.info.name, syscall.ENOTDIR)
+	}
+
+	if count > 0 && len(file.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > len(file.entries) {
+		count = len(file.entries)
+	}
+	entries := file.entries[:count]
+	file.entries = file.entries[count:]
+	return entries, nil
+}
+
+// memWriter is a MemFS file opened by OpenFile
+type memWriter struct {
+	memfs *MemFS
+	node  *memNode
+}
+
+func (writer *memWriter) Write(data []byte) (int, error) {
+	writer.memfs.mutex.Lock()
+	defer writer.memfs.mutex.Unlock()
+
+	// a new slice, so readers of the old content are not changed
+	writer.node.data = append(writer.node.data[:len(writer.node.data):len(writer.node.data)], data...)
+	writer.node.modTime = time.Now()
+	return len(data), nil
+}
+
+func (writer *memWriter) Sync() error {
+	return nil
+}
+
+func (writer *memWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,283 @@
+package file_cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PlanFile is a duplicate of a plan group, only selected files are moved to trash
+type PlanFile struct {
+	Path     string `json:"path"`
+	Selected bool   `json:"selected"`
+}
+
+// PlanGroup is a kept file and its duplicates, TrashDir is the trash session of the scan
+type PlanGroup struct {
+	Keep     string     `json:"keep"`
+	KeepRoot string     `json:"keep_root"`
+	Size     int64      `json:"size"`
+	TrashDir string     `json:"trash_dir"`
+	Files    []PlanFile `json:"files"`
+}
+
+// Reclaimable returns the bytes freed by moving the selected files to trash
+func (group *PlanGroup) Reclaimable() int64 {
+	var size int64
+	for _, file := range group.Files {
+		if file.Selected {
+			size += group.Size
+		}
+	}
+	return size
+}
+
+/*
+Plan is the list of duplicate groups of a scan with the files chosen for trash.
+It is saved as JSON, so the choice can be reviewed and applied later.
+*/
+type Plan struct {
+	Groups []PlanGroup `json:"groups"`
+}
+
+// NewPlan groups the duplicates of the report by the kept file, all duplicates are selected
+func NewPlan(report *Report) *Plan {
+	plan := new(Plan)
+	index := make(map[[2]string]int)
+	for _, strategy := range report.Strategies {
+		for _, entry := range strategy.Entries {
+			if entry.Kind != ReportDuplicate {
+				continue
+			}
+
+			key := [2]string{strategy.TrashDir, entry.Keep}
+			i, ok := index[key]
+			if !ok {
+				i = len(plan.Groups)
+				index[key] = i
+				plan.Groups = append(plan.Groups, PlanGroup{Keep: entry.Keep, KeepRoot: entry.KeepRoot, Size: entry.Size, TrashDir: strategy.TrashDir})
+			}
+			plan.Groups[i].Files = append(plan.Groups[i].Files, PlanFile{Path: entry.Path, Selected: true})
+		}
+	}
+	plan.Sort()
+	return plan
+}
+
+// Sort orders the groups by the reclaimable space, the largest first
+func (plan *Plan) Sort() {
+	sort.SliceStable(plan.Groups, func(i, j int) bool {
+		return plan.Groups[i].Reclaimable() > plan.Groups[j].Reclaimable()
+	})
+}
+
+// Reclaimable returns the bytes freed by applying the plan
+func (plan *Plan) Reclaimable() int64 {
+	var size int64
+	for i := range plan.Groups {
+		size += plan.Groups[i].Reclaimable()
+	}
+	return size
+}
+
+// saveJSON writes the value as indented JSON
+func saveJSON(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// loadJSON reads a file written by saveJSON
+func loadJSON(path string, value interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Save writes the plan as JSON
+func (plan *Plan) Save(path string) error {
+	return saveJSON(path, plan)
+}
+
+// LoadPlan reads a plan written by Plan.Save
+func LoadPlan(path string) (*Plan, error) {
+	plan := new(Plan)
+	if err := loadJSON(path, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Save writes the report as JSON, a report of a dry run is the scan result a Plan is made of
+func (report *Report) Save(path string) error {
+	return saveJSON(path, report)
+}
+
+// LoadReport reads a report written by Report.Save
+func LoadReport(path string) (*Report, error) {
+	report := new(Report)
+	if err := loadJSON(path, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+/*
+Apply moves the selected files to the trash session of their group. The plan may be old,
+each file is compared with the kept file again right before it is moved, as VerifyParanoid does.
+Once the context is done, it stops after the current file operation.
+*/
+func (plan *Plan) Apply(ctx context.Context, fsys FileSystem, cmd CmdLineArgs) (*StrategyReport, error) {
+	fsys = fsOrDefault(fsys)
+	report := &StrategyReport{Name: "plan", Verify: string(VerifyParanoid)}
+	manifests := make(map[string]*Manifest)
+	defer func() {
+		for _, manifest := range manifests {
+			manifest.Close()
+		}
+	}()
+
+	for _, group := range plan.Groups {
+		var keep FileEntry
+		if err := keep.LoadFS(fsys, group.Keep); err != nil {
+			logln("  Skip group, kept file is missing:", group.Keep)
+			continue
+		}
+		keep.root = group.KeepRoot
+
+		if manifests[group.TrashDir] == nil {
+			manifests[group.TrashDir] = NewManifestFS(fsys, group.TrashDir)
+		}
+		parms := ExecuteArgs{Cmd: cmd, Report: report, Manifest: manifests[group.TrashDir], FS: fsys}
+		strategy := SourceToTargetDedupeStrategy{trashPath: group.TrashDir, verify: VerifyParanoid}
+
+		for _, file := range group.Files {
+			if !file.Selected {
+				continue
+			}
+
+			var clean FileEntry
+			if err := clean.LoadFS(fsys, file.Path); err != nil {
+				logln("  Skip missing file:", file.Path)
+				continue
+			}
+			if clean.SameFile(&keep) {
+				logln("  Skip, already the kept file:", file.Path)
+				continue
+			}
+
+			// a real run compares the files right before the move, a dry run compares them here
+			if cmd.DryRun {
+				equal, err := reverify(ctx, fsys, clean.path, keep.path)
+				if err != nil {
+					return report, err
+				}
+				if !equal {
+					logln("  Skip, no longer a duplicate:", file.Path)
+					report.add(ReportEntry{Kind: ReportChanged, Path: clean.path, Keep: keep.path, KeepRoot: keep.root, Size: clean.size})
+					continue
+				}
+			}
+
+			if err := duplicateHandler(ctx, clean, keep, parms, strategy); err != nil {
+				return report, err
+			}
+		}
+	}
+	report.TrashDir = commonTrashDir(plan)
+	return report, nil
+}
+
+/*
+Check makes sure a strategy of the config could have made each group of the plan. The trash session must be
+right below its `trash_dir`, the files below a source and the kept file below a target or the ingest dir.
+A plan that was not made by a scan of the config must be checked before it is applied.
+*/
+func (plan *Plan) Check(config *Config) error {
+	for _, group := range plan.Groups {
+		err := fmt.Errorf("not a trash session of the config: %s", group.TrashDir)
+		for _, name := range config.Strategies() {
+			strategy, ok := config.strategies[name].(*SourceToTargetDedupeStrategy)
+			if !ok || !belowDir(strategy.trashRoot, group.TrashDir, false) {
+				continue
+			}
+			if err = strategy.checkGroup(group); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkGroup returns an error if the files of the group are not below a source or the kept file not below a target
+func (strategy *SourceToTargetDedupeStrategy) checkGroup(group PlanGroup) error {
+	keepers := strategy.targets
+	if strategy.ingest != nil {
+		keepers = append(append([]DirEntry{}, keepers...), DirEntry{path: strategy.ingest.mover.Root(), recursively: true})
+	}
+	if !belowDirEntry(keepers, group.Keep) {
+		return fmt.Errorf("kept file is not below a target: %s", group.Keep)
+	}
+	for _, file := range group.Files {
+		if !belowDirEntry(strategy.source, file.Path) {
+			return fmt.Errorf("file is not below a source: %s", file.Path)
+		}
+	}
+	return nil
+}
+
+// belowDirEntry returns true if the path is a file listed by one of the dir entries
+func belowDirEntry(dirs []DirEntry, path string) bool {
+	for _, dir := range dirs {
+		if belowDir(dir.path, path, dir.recursively) {
+			return true
+		}
+	}
+	return false
+}
+
+// belowDir returns true if the path is inside dir, a direct child only if recursive is false
+func belowDir(dir string, path string, recursive bool) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return false
+	}
+	return recursive || !strings.ContainsRune(rel, filepath.Separator)
+}
+
+// TrashRoots returns the trash roots of the plan, each trash session is a directory below its root
+func (plan *Plan) TrashRoots() []string {
+	var roots []string
+	seen := make(map[string]bool)
+	for _, group := range plan.Groups {
+		root := filepath.Dir(group.TrashDir)
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// commonTrashDir returns the trash session of the plan, empty if the groups use different sessions
+func commonTrashDir(plan *Plan) string {
+	trashDir := ""
+	for _, group := range plan.Groups {
+		if trashDir != "" && group.TrashDir != trashDir {
+			return ""
+		}
+		trashDir = group.TrashDir
+	}
+	return trashDir
+}
@@ -0,0 +1,118 @@
+package file_cleaner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ConfigField describes one key of a strategy entry in the config file
+type ConfigField struct {
+	Key         string
+	Type        string
+	Required    bool
+	Description string
+}
+
+/*
+StrategyInfo describes a strategy type registered under the value of the `strategy` key.
+Factory creates an empty strategy, Config.Load then calls Strategy.Load with the config entry.
+*/
+type StrategyInfo struct {
+	Name        string
+	Description string
+	Schema      []ConfigField
+	Factory     func() (Strategy, error)
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]StrategyInfo)
+)
+
+/*
+RegisterStrategy makes a strategy type available to config files,
+it is usually called from the init function of the package implementing the strategy.
+*/
+func RegisterStrategy(info StrategyInfo) error {
+	if info.Name == "" {
+		return errors.New("strategy name is empty")
+	}
+	if info.Factory == nil {
+		return fmt.Errorf("strategy %s has no factory", info.Name)
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[info.Name]; ok {
+		return fmt.Errorf("strategy already registered: %s", info.Name)
+	}
+	registry[info.Name] = info
+	return nil
+}
+
+// LookupStrategy returns the registered strategy type
+func LookupStrategy(name string) (StrategyInfo, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	info, ok := registry[name]
+	return info, ok
+}
+
+// RegisteredStrategies returns all registered strategy types sorted by name
+func RegisteredStrategies() []StrategyInfo {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	infos := make([]StrategyInfo, 0, len(registry))
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// dirEntrySchema is the description shared by the DirEntry keys
+const dirEntrySchema = "DirEntry with path, recursive, ignore, match and symlinks"
+
+func init() {
+	builtins := []StrategyInfo{
+		{
+			Name:        "source_to_target_dedupe",
+			Description: "move source files that already exist in the targets to trash, optionally ingest the unique ones",
+			Schema: []ConfigField{
+				{Key: "target_dir", Type: "object", Description: dirEntrySchema + ", required if target_dirs is not set"},
+				{Key: "target_dirs", Type: "array", Description: "list of " + dirEntrySchema},
+				{Key: "trash_dir", Type: "string", Required: true, Description: "trash directory, each run creates a timestamp session"},
+				{Key: "source_dirs", Type: "array", Required: true, Description: "list of " + dirEntrySchema},
+				{Key: "verify", Type: "string", Description: "size+hash, hash+bytes (default) or paranoid"},
+				{Key: "ingest", Type: "object", Description: "move unique source files into the target, keys dir, layout, template and collision"},
+				{Key: "schedule", Type: "string", Description: "cron expression or @every interval for the daemon"},
+			},
+			Factory: func() (Strategy, error) {
+				return new(SourceToTargetDedupeStrategy), nil
+			},
+		},
+		{
+			Name:        "pdf_mover",
+			Description: "move matching pdf files from source_dir to target_dir (not implemented)",
+			Schema: []ConfigField{
+				{Key: "pdf_matcher", Type: "string", Required: true, Description: "name of the matcher, e.g. conference_paper_detector"},
+				{Key: "target_dir", Type: "object", Required: true, Description: dirEntrySchema},
+				{Key: "source_dir", Type: "object", Required: true, Description: dirEntrySchema},
+			},
+			Factory: func() (Strategy, error) {
+				logln("Loading pdf_mover strategy")
+				return nil, errors.New("pdf_mover strategy not implemented")
+				// return new(PdfMoverStrategy), nil
+			},
+		},
+	}
+
+	for _, info := range builtins {
+		if err := RegisterStrategy(info); err != nil {
+			panic(err)
+		}
+	}
+}
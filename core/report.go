@@ -0,0 +1,116 @@
+package file_cleaner
+
+const (
+	// ReportDuplicate is a source file with the same content as a target file
+	ReportDuplicate = "duplicate"
+	// ReportHardlink is a source file that is already a hardlink to a target file, it is never trashed
+	ReportHardlink = "hardlink"
+	// ReportIngest is a unique source file moved into the target tree
+	ReportIngest = "ingest"
+	// ReportCollision is a unique source file not ingested because the destination already exists
+	ReportCollision = "collision"
+	// ReportChanged is a duplicate not moved because a file changed between scan and action
+	ReportChanged = "changed"
+	// ReportSkipped is a duplicate the Decider chose to keep
+	ReportSkipped = "skipped"
+)
+
+// ReportEntry records one decision made by a strategy
+type ReportEntry struct {
+	Kind      string `json:"kind"`
+	Path      string `json:"path"`
+	Keep      string `json:"keep"`
+	KeepRoot  string `json:"keep_root"`
+	Size      int64  `json:"size"`
+	TrashPath string `json:"trash_path,omitempty"`
+
+	// Destination is the new path of an ingested file
+	Destination string `json:"destination,omitempty"`
+
+	// inode of a duplicate, its names free the space once
+	inode *inodeKey
+}
+
+// StrategyReport is the result of a single strategy run
+type StrategyReport struct {
+	Name     string        `json:"name"`
+	Strategy string        `json:"strategy"`
+	Entries  []ReportEntry `json:"entries"`
+
+	// Verify is the VerifyMode duplicates were confirmed with
+	Verify string `json:"verify,omitempty"`
+
+	// TrashDir is the trash session of the run, the manifest is stored in it
+	TrashDir string `json:"trash_dir,omitempty"`
+
+	// Stats are set by Config.Execute
+	Stats *Stats `json:"stats,omitempty"`
+
+	// Actions are the file operations of the duplicates and ingested files, run or listed by a dry run
+	Actions []Action `json:"actions,omitempty"`
+}
+
+// Report is the result of Config.Execute
+type Report struct {
+	Strategies []*StrategyReport `json:"strategies"`
+
+	// Total are the stats of all strategies, set by Config.Execute
+	Total *Stats `json:"total,omitempty"`
+}
+
+// add a new entry to the strategy report
+func (report *StrategyReport) add(entry ReportEntry) {
+	if report == nil {
+		return
+	}
+	report.Entries = append(report.Entries, entry)
+}
+
+// addActions appends the file operations to the strategy report
+func (report *StrategyReport) addActions(actions ...Action) {
+	if report == nil {
+		return
+	}
+	report.Actions = append(report.Actions, actions...)
+}
+
+// Count returns the number of entries of the given kind
+func (report *StrategyReport) Count(kind string) int {
+	count := 0
+	for _, entry := range report.Entries {
+		if entry.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Print prints a summary of the report to the console
+func (report *Report) Print() {
+	logln("Summary:")
+	for _, strategy := range report.Strategies {
+		logln("  Strategy:", strategy.Name)
+		if strategy.Verify != "" {
+			logln("    Verify:", strategy.Verify)
+		}
+		logln("    Duplicates:", strategy.Count(ReportDuplicate))
+		if changed := strategy.Count(ReportChanged); changed > 0 {
+			logln("    Changed before action:", changed)
+		}
+		if skipped := strategy.Count(ReportSkipped); skipped > 0 {
+			logln("    Skipped by user:", skipped)
+		}
+		logln("    Existing hardlinks:", strategy.Count(ReportHardlink))
+		if ingested, collisions := strategy.Count(ReportIngest), strategy.Count(ReportCollision); ingested+collisions > 0 {
+			logln("    Ingested:", ingested)
+			logln("    Name collisions:", collisions)
+		}
+		if strategy.Stats != nil {
+			strategy.Stats.Print("    ")
+		}
+	}
+	if report.Total != nil && len(report.Strategies) > 1 {
+		logln("  Total:")
+		report.Total.Print("    ")
+	}
+}
@@ -0,0 +1,110 @@
+package file_cleaner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DuplicateSet is a set of files with the same content
+type DuplicateSet struct {
+	Size  int64    `json:"size"`
+	Files []string `json:"files"`
+}
+
+/*
+FindDuplicates lists the dirs and groups the files with the same content, nothing is moved.
+A file listed by two overlapping dirs is listed once, hardlinks of the same inode are not duplicates.
+The error is only set if the context is done.
+*/
+func FindDuplicates(ctx context.Context, fsys ReadFS, dirs []DirEntry) ([]DuplicateSet, error) {
+	sizeIndex := make(map[int64]([]FileEntry))
+	fileMap := make(map[string]FileEntry)
+	for _, dir := range dirs {
+		dirSizeIndex, dirFileMap, err := ListFilesFS(ctx, fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		mergeSizeIndex(sizeIndex, fileMap, dirSizeIndex)
+		for path, entry := range dirFileMap {
+			fileMap[path] = entry
+		}
+	}
+
+	var sets []DuplicateSet
+	for size, entries := range sizeIndex {
+		if len(entries) < 2 {
+			continue
+		}
+
+		// each set is compared by its first file, the hashes are cached in the entries
+		var groups [][]*FileEntry
+		for i := range entries {
+			entry := &entries[i]
+			found := false
+			for j, group := range groups {
+				if entry.SameFile(group[0]) {
+					found = true
+					break
+				}
+				equal, err := entry.CompareContext(ctx, group[0])
+				if err != nil {
+					return nil, err
+				}
+				if equal {
+					groups[j] = append(group, entry)
+					found = true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, []*FileEntry{entry})
+			}
+		}
+
+		for _, group := range groups {
+			if len(group) < 2 {
+				continue
+			}
+			set := DuplicateSet{Size: size}
+			for _, entry := range group {
+				set.Files = append(set.Files, entry.path)
+			}
+			sort.Strings(set.Files)
+			sets = append(sets, set)
+		}
+	}
+
+	// the largest first, like the plan
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Size != sets[j].Size {
+			return sets[i].Size > sets[j].Size
+		}
+		return sets[i].Files[0] < sets[j].Files[0]
+	})
+	return sets, nil
+}
+
+/*
+WriteFdupes writes the sets in the output format of fdupes, one path per line and a blank line
+after each set. With showSize each set starts with its size like fdupes -S.
+*/
+func WriteFdupes(writer io.Writer, sets []DuplicateSet, showSize bool) error {
+	for _, set := range sets {
+		if showSize {
+			if _, err := fmt.Fprintf(writer, "%d bytes each:\n", set.Size); err != nil {
+				return err
+			}
+		}
+		for _, path := range set.Files {
+			if _, err := fmt.Fprintln(writer, path); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package file_cleaner
+
+import (
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+)
+
+// statsTop is the number of largest duplicates and directories kept in Stats
+const statsTop = 10
+
+// DirStat is the space a directory frees once its duplicates are trashed
+type DirStat struct {
+	Dir   string `json:"dir"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+/*
+Stats are the numbers of a strategy run. A dry run counts the bytes it would reclaim.
+SizeCollisions are the source files with the size of a target file, only their content is read.
+BytesHashed counts each file hashed by the scan once, comparing the content and the re-check before a move are not counted.
+BytesReclaimed counts the size of a file with several hardlink names once.
+*/
+type Stats struct {
+	FilesScanned    int   `json:"files_scanned"`
+	BytesScanned    int64 `json:"bytes_scanned"`
+	SizeBuckets     int   `json:"size_buckets"`
+	SizeCollisions  int   `json:"size_collisions"`
+	BytesHashed     int64 `json:"bytes_hashed"`
+	DuplicateGroups int   `json:"duplicate_groups"`
+	Duplicates      int   `json:"duplicates"`
+	BytesReclaimed  int64 `json:"bytes_reclaimed"`
+
+	LargestDuplicates []ReportEntry `json:"largest_duplicates,omitempty"`
+	TopDirs           []DirStat     `json:"top_dirs,omitempty"`
+
+	// sizes are the distinct sizes of the scanned files
+	sizes map[int64]bool
+}
+
+// scan adds the listed files to the stats, targets are nil for the target index itself
+func (stats *Stats) scan(sizeIndex map[int64]([]FileEntry), targets map[int64]([]FileEntry)) {
+	if stats == nil {
+		return
+	}
+	if stats.sizes == nil {
+		stats.sizes = make(map[int64]bool)
+	}
+	for size, entries := range sizeIndex {
+		stats.FilesScanned += len(entries)
+		stats.BytesScanned += size * int64(len(entries))
+		stats.sizes[size] = true
+		if _, ok := targets[size]; ok {
+			stats.SizeCollisions += len(entries)
+		}
+	}
+	stats.SizeBuckets = len(stats.sizes)
+}
+
+// addEntries counts the duplicates of a report, the largest and the top directories are kept
+func (stats *Stats) addEntries(entries []ReportEntry) {
+	groups := make(map[string]bool)
+	dirs := make(map[string]*DirStat)
+	reclaimed := make(map[inodeKey]bool)
+	for _, entry := range entries {
+		if entry.Kind != ReportDuplicate {
+			continue
+		}
+		groups[entry.Keep] = true
+		stats.Duplicates++
+
+		// all names of a hardlinked file are trashed, its space is freed once
+		if entry.inode == nil || !reclaimed[*entry.inode] {
+			stats.BytesReclaimed += entry.Size
+			if entry.inode != nil {
+				reclaimed[*entry.inode] = true
+			}
+		}
+		stats.LargestDuplicates = append(stats.LargestDuplicates, entry)
+
+		dir := filepath.Dir(entry.Path)
+		if dirs[dir] == nil {
+			dirs[dir] = &DirStat{Dir: dir}
+		}
+		dirs[dir].Files++
+		dirs[dir].Size += entry.Size
+	}
+	stats.DuplicateGroups += len(groups)
+
+	for _, dir := range dirs {
+		stats.TopDirs = append(stats.TopDirs, *dir)
+	}
+	stats.trim()
+}
+
+// trim sorts the largest duplicates and directories and keeps the first statsTop
+func (stats *Stats) trim() {
+	sort.SliceStable(stats.LargestDuplicates, func(i, j int) bool {
+		return stats.LargestDuplicates[i].Size > stats.LargestDuplicates[j].Size
+	})
+	if len(stats.LargestDuplicates) > statsTop {
+		stats.LargestDuplicates = stats.LargestDuplicates[:statsTop]
+	}
+
+	sort.SliceStable(stats.TopDirs, func(i, j int) bool {
+		if stats.TopDirs[i].Size != stats.TopDirs[j].Size {
+			return stats.TopDirs[i].Size > stats.TopDirs[j].Size
+		}
+		return stats.TopDirs[i].Dir < stats.TopDirs[j].Dir
+	})
+	if len(stats.TopDirs) > statsTop {
+		stats.TopDirs = stats.TopDirs[:statsTop]
+	}
+}
+
+/*
+TotalStats sums the stats of all strategies. A directory in the top of two strategies is merged,
+size buckets are summed, a size seen by two strategies counts twice.
+*/
+func (report *Report) TotalStats() *Stats {
+	total := new(Stats)
+	dirs := make(map[string]int)
+	for _, strategy := range report.Strategies {
+		stats := strategy.Stats
+		if stats == nil {
+			continue
+		}
+		total.FilesScanned += stats.FilesScanned
+		total.BytesScanned += stats.BytesScanned
+		total.SizeBuckets += stats.SizeBuckets
+		total.SizeCollisions += stats.SizeCollisions
+		total.BytesHashed += stats.BytesHashed
+		total.DuplicateGroups += stats.DuplicateGroups
+		total.Duplicates += stats.Duplicates
+		total.BytesReclaimed += stats.BytesReclaimed
+		total.LargestDuplicates = append(total.LargestDuplicates, stats.LargestDuplicates...)
+
+		for _, dir := range stats.TopDirs {
+			if i, ok := dirs[dir.Dir]; ok {
+				total.TopDirs[i].Files += dir.Files
+				total.TopDirs[i].Size += dir.Size
+				continue
+			}
+			dirs[dir.Dir] = len(total.TopDirs)
+			total.TopDirs = append(total.TopDirs, dir)
+		}
+	}
+	total.trim()
+	return total
+}
+
+// Print prints the stats indented below a strategy or the total
+func (stats *Stats) Print(indent string) {
+	logf("%sFiles scanned: %d (%s)\n", indent, stats.FilesScanned, FormatSize(stats.BytesScanned))
+	logf("%sSize buckets: %d, files with the size of a target: %d\n", indent, stats.SizeBuckets, stats.SizeCollisions)
+	logf("%sBytes hashed: %s\n", indent, FormatSize(stats.BytesHashed))
+	logf("%sDuplicate groups: %d\n", indent, stats.DuplicateGroups)
+	logf("%sBytes reclaimed: %s\n", indent, FormatSize(stats.BytesReclaimed))
+	if len(stats.LargestDuplicates) > 0 {
+		logf("%sLargest duplicates:\n", indent)
+		for _, entry := range stats.LargestDuplicates {
+			logf("%s  %10s  %s\n", indent, FormatSize(entry.Size), entry.Path)
+		}
+	}
+	if len(stats.TopDirs) > 0 {
+		logf("%sTop directories:\n", indent)
+		for _, dir := range stats.TopDirs {
+			logf("%s  %10s  %s (%d files)\n", indent, FormatSize(dir.Size), dir.Dir, dir.Files)
+		}
+	}
+}
+
+// hashingFS counts the bytes hashed by the entries listed from it, comparing the content is not counted
+type hashingFS struct {
+	FileSystem
+	hashed int64
+}
+
+// addHashed adds the bytes hashed of one file
+func (fsys *hashingFS) addHashed(size int64) {
+	atomic.AddInt64(&fsys.hashed, size)
+}
+
+// bytesHashed returns the bytes hashed so far
+func (fsys *hashingFS) bytesHashed() int64 {
+	return atomic.LoadInt64(&fsys.hashed)
+}
@@ -1,112 +1,367 @@
 package file_cleaner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
-// it is the argument for cmd line
+// CmdLineArgs are the options of a run, the cmd line flags of the same name set them
 type CmdLineArgs struct {
 	DryRun           bool
 	ReplaceAsSymlink bool
 }
 
+/*
+ExecuteArgs are passed to Strategy.Execute. Config.Execute sets all fields,
+a strategy must accept nil Report and Manifest when it is executed directly.
+*/
 type ExecuteArgs struct {
-	cmd    CmdLineArgs
-	config Config
+	Cmd    CmdLineArgs
+	Config Config
+
+	// Report of the running strategy
+	Report *StrategyReport
+
+	// Manifest of the trash session of the running strategy
+	Manifest *Manifest
+
+	// FS the strategy reads and changes, nil is the OS file system
+	FS FileSystem
+
+	// Decider confirms each duplicate group, nil keeps the first matching target
+	Decider Decider
 }
 
 /*
-Strategy defines the what to do with the file
+Strategy defines the what to do with the file.
+Execute must stop between file operations once the context is done and return the context error.
 */
 type Strategy interface {
 	Load(name string, value map[string]interface{}) error
-	Execute(parms ExecuteArgs) error
+	Execute(ctx context.Context, parms ExecuteArgs) error
+}
+
+// fs returns the file system of the run
+func (parms ExecuteArgs) fs() FileSystem {
+	return fsOrDefault(parms.FS)
 }
 
 func ListFiles(dirEntry DirEntry) (map[int64]([]FileEntry), map[string]FileEntry) {
+	sizeIndex, fileMap, _ := ListFilesContext(context.Background(), dirEntry)
+	return sizeIndex, fileMap
+}
+
+/*
+ListFilesContext is ListFiles that stops walking once the context is done,
+the error is only set if the context is done.
+*/
+func ListFilesContext(ctx context.Context, dirEntry DirEntry) (map[int64]([]FileEntry), map[string]FileEntry, error) {
+	return ListFilesFS(ctx, OSFS{}, dirEntry)
+}
+
+/*
+ListFilesFS is ListFilesContext on the given file system,
+the paths of the DirEntry and of the result are OS paths.
+*/
+func ListFilesFS(ctx context.Context, fsys ReadFS, dirEntry DirEntry) (map[int64]([]FileEntry), map[string]FileEntry, error) {
 	recursively := dirEntry.recursively
 	includeDirs := dirEntry.include_dirs
 
 	// list all target files and create a map of size to file, is can chceck quickly if a file exists without reading the file
 	sizeIndex := make(map[int64]([]FileEntry))
 	fileMap := make(map[string]FileEntry)
-	filepath.Walk(dirEntry.path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
 
-		// check if file is directory
-		if info.IsDir() && !recursively && path != dirEntry.path {
-			return filepath.SkipDir
-		}
+	// real paths of the walked directories, used to detect symlink loops
+	visited := make(map[string]bool)
 
-		// check is not match
-		if !dirEntry.Match(path) {
-			return nil
-		}
+	// position of each inode in the size index, names of the same inode are collapsed
+	inodeIndex := make(map[inodeKey]int)
+
+	// walk the real directory and report paths below displayRoot, so followed symlinks keep the link path
+	var walk func(realRoot string, displayRoot string) error
+	walk = func(realRoot string, displayRoot string) error {
+		return fs.WalkDir(fsys, FSName(realRoot), func(name string, info fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				return err
+			}
+
+			realPath := osPath(name)
+			path := filepath.Join(displayRoot, strings.TrimPrefix(realPath, realRoot))
+			if realPath == realRoot {
+				path = displayRoot
+			}
+
+			if info.IsDir() {
+				// check if file is directory
+				if !recursively && path != dirEntry.path {
+					return filepath.SkipDir
+				}
+				visited[realPath] = true
+			}
+
+			// check is not match
+			if !dirEntry.Match(path) {
+				return nil
+			}
+
+			// skip if it is directory
+			if info.IsDir() && !includeDirs {
+				return nil
+			}
+
+			entry := FileEntry{}
+			if info.Type()&fs.ModeSymlink != 0 {
+				switch dirEntry.symlinks {
+				case SymlinkFollow:
+					linkReal, err := evalSymlinks(fsys, realPath)
+					if err != nil {
+						logln("  Skip broken symlink:", path)
+						return nil
+					}
+
+					linkInfo, err := fsys.Stat(FSName(linkReal))
+					if err != nil {
+						logln("  Skip broken symlink:", path)
+						return nil
+					}
+
+					if linkInfo.IsDir() {
+						if !recursively {
+							return nil
+						}
+						if visited[linkReal] {
+							logln("  Skip symlink loop:", path, "->", linkReal)
+							return nil
+						}
+						return walk(linkReal, path)
+					}
+
+					if err := entry.LoadFS(fsys, path); err != nil {
+						logln("  Skip symlink:", path, err)
+						return nil
+					}
+				case SymlinkAsLink:
+					// the link is listed, but never indexed by size
+					if err := entry.LoadLinkFS(fsys, path); err != nil {
+						logln("  Skip symlink:", path, err)
+						return nil
+					}
+					entry.root = dirEntry.path
+					fileMap[path] = entry
+					return nil
+				default:
+					return nil
+				}
+			} else if err := entry.LoadFS(fsys, path); err != nil {
+				logln("  Skip file:", path, err)
+				return nil
+			}
+			entry.root = dirEntry.path
+
+			fileMap[path] = entry
+
+			// another name of an indexed inode is a hardlink, not a duplicate
+			if entry.hasID {
+				key := inodeKey{entry.dev, entry.ino}
+				if i, ok := inodeIndex[key]; ok {
+					// a followed symlink to an indexed file is the same file, not another name
+					if !entry.isSymlink {
+						indexed := &sizeIndex[entry.size][i]
+						indexed.hardlinks = append(indexed.hardlinks, path)
+					}
+					return nil
+				}
+				if !entry.isSymlink {
+					inodeIndex[key] = len(sizeIndex[entry.size])
+				}
+			}
+
+			// make index and map
+			if sizeIndex[entry.size] == nil {
+				sizeIndex[entry.size] = []FileEntry{entry}
+			} else {
+				sizeIndex[entry.size] = append(sizeIndex[entry.size], entry)
+			}
 
-		// skip if it is directory
-		if info.IsDir() && !includeDirs {
 			return nil
+		})
+	}
+
+	// the configured root is always resolved, even if it is a symlink
+	realRoot, err := evalSymlinks(fsys, dirEntry.path)
+	if err != nil {
+		realRoot = osPath(FSName(dirEntry.path))
+	}
+	walk(realRoot, dirEntry.path)
+
+	return sizeIndex, fileMap, ctx.Err()
+}
+
+// mergeSizeIndex appends the entries of src to dst, entries already in fileMap are skipped
+// so a file listed by two overlapping targets is indexed once
+func mergeSizeIndex(dst map[int64]([]FileEntry), fileMap map[string]FileEntry, src map[int64]([]FileEntry)) {
+	for size, entries := range src {
+		for _, entry := range entries {
+			if _, ok := fileMap[entry.path]; !ok {
+				dst[size] = append(dst[size], entry)
+			}
 		}
+	}
+}
 
-		entry := FileEntry{}
-		entry.Load(path)
+// trashPathFor returns the path of the file inside the trash, it keeps the original absolute path
+func trashPathFor(trashRoot string, path string) string {
+	absPath, _ := filepath.Abs(path)
+	return filepath.Join(trashRoot, absPath)
+}
 
-		// make index and map
-		if sizeIndex[entry.size] == nil {
-			sizeIndex[entry.size] = []FileEntry{entry}
-		} else {
-			sizeIndex[entry.size] = append(sizeIndex[entry.size], entry)
+/*
+duplicateHandler moves the duplicate to trash and replaces it with a symlink if requested.
+Once started, the operation is finished even if the context is done.
+*/
+func duplicateHandler(ctx context.Context, clean FileEntry, keep FileEntry, parms ExecuteArgs, strategy SourceToTargetDedupeStrategy) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	logln("  Duplicate:", clean.path)
+	logln("    Target:", keep.path)
+	logln("    Target Root:", keep.root)
+
+	// a long scan gives the user time to edit either file, both must be as they were listed
+	fsys := parms.fs()
+	if !parms.Cmd.DryRun && (!clean.unchanged(fsys) || !keep.unchanged(fsys)) {
+		logln("    Changed since scan, skipped:", clean.path)
+		parms.Report.add(ReportEntry{Kind: ReportChanged, Path: clean.path, Keep: keep.path, KeepRoot: keep.root, Size: clean.size})
+		return nil
+	}
+
+	// paranoid reads both files again, the content may have changed without the size and mtime
+	if strategy.verify == VerifyParanoid && !parms.Cmd.DryRun {
+		equal, err := reverify(ctx, fsys, clean.path, keep.path)
+		if err != nil {
+			return err
 		}
-		fileMap[path] = entry
+		if !equal {
+			logln("    Changed since scan, skipped:", clean.path)
+			parms.Report.add(ReportEntry{Kind: ReportChanged, Path: clean.path, Keep: keep.path, KeepRoot: keep.root, Size: clean.size})
+			return nil
+		}
+	}
 
+	// the same actions are run by a real run and listed by a dry run
+	trashPath := trashPathFor(strategy.trashPath, clean.path)
+	actions := duplicateActions(clean, keep, trashPath, parms.Cmd.ReplaceAsSymlink)
+	logln("    Moving to trash:", clean.path)
+	logln("    Trash Path:", trashPath)
+	if parms.Cmd.ReplaceAsSymlink {
+		logln("    Replacing with symlink:", clean.path, "->", keep.path)
+	}
+	entry := ReportEntry{Kind: ReportDuplicate, Path: clean.path, Keep: keep.path, KeepRoot: keep.root, Size: clean.size, TrashPath: trashPath, inode: clean.inode()}
+	if parms.Cmd.DryRun {
+		logln("    Dry Run: Not moving to trash")
+		parms.Report.add(entry)
+		parms.Report.addActions(actions...)
 		return nil
-	})
+	}
 
-	return sizeIndex, fileMap
+	// the duplicate is reported once it is in the trash, even if the symlink fails
+	moved := false
+	for _, action := range actions {
+		if err := action.run(fsys); err != nil {
+			logln("    Error running", action.Kind+":", err)
+			break
+		}
+		parms.Report.addActions(action)
+
+		var err error
+		switch action.Kind {
+		case ActionMove:
+			moved = true
+			err = parms.Manifest.Record(ManifestTrash, action.From, action.To)
+		case ActionSymlink:
+			err = parms.Manifest.Record(ManifestSymlink, action.From, action.To)
+		}
+		if err != nil {
+			logln("    Error writing manifest:", err)
+		}
+	}
+	if moved {
+		parms.Report.add(entry)
+	}
+	return nil
 }
 
-func duplicateHandler(clean FileEntry, keep FileEntry, parms ExecuteArgs, strategy SourceToTargetDedupeStrategy) {
-	fmt.Println("  Duplicate:", clean.path)
-	fmt.Println("    Target:", keep.path)
-
-	// move to trash
-	absPath, _ := filepath.Abs(clean.path)
-	trashPath := filepath.Join(strategy.trashPath, absPath)
-	fmt.Println("    Moving to trash:", clean.path)
-	fmt.Println("    Trash Path:", trashPath)
-	if !parms.cmd.DryRun {
-		os.MkdirAll(filepath.Dir(trashPath), os.ModePerm)
-		os.Rename(clean.path, trashPath)
-	} else {
-		fmt.Println("    Dry Run: Not moving to trash")
+/*
+reverify loads and compares both files without the cached hashes of the scan,
+the error is only set if the context is done.
+*/
+func reverify(ctx context.Context, fsys ReadFS, path string, other string) (bool, error) {
+	// the re-check is not part of the hashing stats of the scan
+	if counter, ok := fsys.(*hashingFS); ok {
+		fsys = counter.FileSystem
 	}
 
-	if parms.cmd.ReplaceAsSymlink {
-		fmt.Println("    Replacing with symlink:", clean.path, "->", keep.path)
-		if !parms.cmd.DryRun {
-			os.Symlink(keep.path, clean.path)
-		} else {
-			fmt.Println("    Dry Run: Not creating symlink")
-		}
-		// create symlink
+	var entry, otherEntry FileEntry
+	if err := entry.LoadFS(fsys, path); err != nil {
+		return false, nil
+	}
+	if err := otherEntry.LoadFS(fsys, other); err != nil {
+		return false, nil
 	}
+	return entry.CompareContext(ctx, &otherEntry)
+}
 
+// compareOptions returns the options of the verify mode
+func (strategy *SourceToTargetDedupeStrategy) compareOptions() CompareOptions {
+	return CompareOptions{TrustHash: strategy.verify == VerifySizeHash}
 }
 
+/*
+pathNomalize returns the absolute path with symlinks resolved and a trailing separator,
+so a prefix check never matches a sibling such as /etc/host and /etc/hostname.
+*/
 func pathNomalize(path string) (string, error) {
-	path = filepath.Clean(path)
-	path, err := filepath.Abs(path)
-	if err != nil {
-		return "", err
+	// .. is resolved after the symlinks before it, so the path is not cleaned first
+	if !filepath.IsAbs(path) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		path = cwd + string(filepath.Separator) + path
+	}
+
+	path = evalExistingSymlinks(path)
+	if !strings.HasSuffix(path, string(filepath.Separator)) {
+		path += string(filepath.Separator)
 	}
-	path += string(filepath.Separator)
 	return path, nil
 }
 
+/*
+evalExistingSymlinks resolves the symlinks of the longest existing prefix of the absolute path,
+the rest of the path does not exist yet and is cleaned.
+*/
+func evalExistingSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	i := strings.LastIndex(path, string(filepath.Separator))
+	if i <= len(filepath.VolumeName(path)) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(evalExistingSymlinks(path[:i]), path[i+1:])
+}
+
 /*
 PathNomalizePair normalize the path and return the normalized path
 */
@@ -126,9 +381,9 @@ func PathNomalizePair(path1 string, path2 string) (string, string, error) {
 }
 
 // check if path1 is subpath of path2
-// it path1 should be shorter than path2
+// both paths must be normalized by pathNomalize
 func checkIsSubPath(path1 string, path2 string) bool {
-	return path2[:len(path1)] == path1
+	return strings.HasPrefix(path2, path1)
 }
 
 func SetShorterPathFirst(path1 string, path2 string) (string, string, bool) {
@@ -161,6 +416,11 @@ func IsPathNotIndepentRecursive(path1 string, recPath1 bool, path2 string, recPa
 		return true, err
 	}
 
+	// the same directory is never independent, whichever entry is recursive
+	if path1 == path2 {
+		return true, nil
+	}
+
 	// make sure path1 is shorter
 	path1, path2, swapped := SetShorterPathFirst(path1, path2)
 	if swapped {
@@ -177,62 +437,265 @@ func IsPathNotIndepentRecursive(path1 string, recPath1 bool, path2 string, recPa
 		return false, nil
 	}
 
-	// if we not recursive path1 and path2, it is independent only if path1 not equal to path2
-	return path1 == path2, nil
+	// if we not recursive path1 and path2, it is independent because path1 not equal to path2
+	return false, nil
 }
 
-func (strategy *SourceToTargetDedupeStrategy) Execute(parms ExecuteArgs) error {
-	fmt.Println("Execute SourceToTargetDedupeStrategy")
-	fmt.Println("Target:", strategy.target.path)
+// indexTargets lists all targets and merges them into one size index
+func (strategy *SourceToTargetDedupeStrategy) indexTargets(ctx context.Context, fsys ReadFS) (map[int64]([]FileEntry), map[string]FileEntry, error) {
+	sizeIndex := make(map[int64]([]FileEntry))
+	fileMap := make(map[string]FileEntry)
+	for _, target := range strategy.targets {
+		logln("Target:", target.path)
 
-	// if target directory does not exist, throw an error
-	if _, err := os.Stat(strategy.target.path); os.IsNotExist(err) {
-		return err
+		// if target directory does not exist, throw an error
+		if _, err := fsys.Stat(FSName(target.path)); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, err
+		}
+
+		targetSizeIndex, targetFileMap, err := ListFilesFS(ctx, fsys, target)
+		if err != nil {
+			return nil, nil, err
+		}
+		mergeSizeIndex(sizeIndex, fileMap, targetSizeIndex)
+		for path, entry := range targetFileMap {
+			fileMap[path] = entry
+		}
 	}
+	return sizeIndex, fileMap, nil
+}
 
-	sizeIndex, fileMap := ListFiles(strategy.target)
+// checkIndependent makes sure no source overlaps a target or the ingest directory
+func (strategy *SourceToTargetDedupeStrategy) checkIndependent() error {
+	for _, source := range strategy.source {
+		for _, target := range strategy.targets {
+			notIndepent, err := IsPathNotIndepentRecursive(source.path, source.recursively, target.path, target.recursively)
+			if err != nil {
+				return err
+			}
+
+			if notIndepent {
+				return fmt.Errorf("source %s overlaps target %s", source.path, target.path)
+			}
+		}
+
+		// the ingest directory must not be walked as a source
+		if strategy.ingest != nil {
+			notIndepent, err := IsPathNotIndepent(source.path, strategy.ingest.mover.Root())
+			if err != nil {
+				return err
+			}
+			if notIndepent {
+				return fmt.Errorf("ingest dir %s overlaps source %s", strategy.ingest.mover.Root(), source.path)
+			}
+		}
+	}
+	return nil
+}
+
+func (strategy *SourceToTargetDedupeStrategy) Execute(ctx context.Context, parms ExecuteArgs) error {
+	logln("Execute SourceToTargetDedupeStrategy")
+	if parms.Report == nil {
+		parms.Report = new(StrategyReport)
+	}
+	parms.Report.Strategy = strategy.super.strategy
+	parms.Report.Verify = string(strategy.verify)
+
+	// each run moves files to its own trash session
+	strategy.newTrashSession()
+	logln("Trash Path:", strategy.trashPath)
+	parms.Report.TrashDir = strategy.trashPath
+	if parms.Manifest == nil {
+		parms.Manifest = NewManifestFS(parms.fs(), strategy.trashPath)
+		defer parms.Manifest.Close()
+	}
+
+	sizeIndex, fileMap, err := strategy.indexTargets(ctx, parms.fs())
+	if err != nil {
+		return err
+	}
+	parms.Report.Stats.scan(sizeIndex, nil)
 
 	// print all target files
 	for path := range fileMap {
-		fmt.Println("  Target:", path)
+		logln("  Target:", path)
+	}
+
+	if err := strategy.checkIndependent(); err != nil {
+		return err
 	}
 
+	// destinations of ingested files in this run
+	planned := make(map[string]bool)
+
 	for _, source := range strategy.source {
-		notIndepent, err := IsPathNotIndepentRecursive(source.path, source.recursively, strategy.target.path, strategy.target.recursively)
+		logln("Source:", source.path)
+		sourceSizeIndex, _, err := ListFilesFS(ctx, parms.fs(), source)
 		if err != nil {
 			return err
 		}
+		parms.Report.Stats.scan(sourceSizeIndex, sizeIndex)
+
+		// only files indexed by size are candidates, links listed as_link are never trashed
+		for _, entries := range sourceSizeIndex {
+			for _, entry := range entries {
+				handled, err := strategy.dedupeEntry(ctx, entry, sizeIndex, parms)
+				if err != nil {
+					return err
+				}
+				if handled || strategy.ingest == nil {
+					continue
+				}
+
+				// ingested files join the index, so a later copy in the sources is a duplicate
+				moved, ok, err := ingestHandler(ctx, entry, source, parms, *strategy, planned)
+				if err != nil {
+					return err
+				}
+				if ok {
+					sizeIndex[moved.size] = append(sizeIndex[moved.size], moved)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+dedupeEntry compares the source entry with the target index and handles the duplicate,
+it returns false if the entry is unique. The error is only set if the context is done.
+*/
+func (strategy *SourceToTargetDedupeStrategy) dedupeEntry(ctx context.Context, entry FileEntry, sizeIndex map[int64]([]FileEntry), parms ExecuteArgs) (bool, error) {
+	// check if file duplicates
+	targetEntries, ok := sizeIndex[entry.size]
+	if !ok {
+		return false, nil
+	}
+
+	// look for an existing link to any target first, an equal target earlier
+	// in the list must not win over the one the source is already linked to
+	if linked(entry, targetEntries, parms) {
+		return true, nil
+	}
+
+	// all equal targets are only collected if a Decider picks the keeper
+	var keepers []*FileEntry
+	for i := range targetEntries {
+		// the hashes are cached in the index, each target is hashed once per run
+		targetEntry := &targetEntries[i]
 
-		if notIndepent {
-			panic(fmt.Sprintf("current not support source and target are the same %s %s", source.path, strategy.target.path))
+		equal, err := entry.CompareWith(ctx, targetEntry, strategy.compareOptions())
+		if err != nil {
+			return false, err
 		}
 
-		fmt.Println("Source:", source.path)
-		_, sourceFileMap := ListFiles(source)
+		if equal && entry.path != targetEntry.path {
+			keepers = append(keepers, targetEntry)
+			if parms.Decider == nil {
+				break
+			}
+		}
+	}
+	if len(keepers) == 0 {
+		return false, nil
+	}
 
-		// print all source files
-		for _, entry := range sourceFileMap {
-			// check if file duplicates
-			if targetEntries, ok := sizeIndex[entry.size]; ok {
-				for _, targetEntry := range targetEntries {
-					if entry.Equal(&targetEntry) && entry.path != targetEntry.path {
-						duplicateHandler(entry, targetEntry, parms, *strategy)
-					}
-				}
+	keep := keepers[0]
+	if parms.Decider != nil {
+		group := DuplicateGroup{Source: entry}
+		for _, keeper := range keepers {
+			group.Keepers = append(group.Keepers, *keeper)
+		}
+		decision, err := parms.Decider.Decide(group)
+		if err != nil {
+			return true, err
+		}
+		if decision.Skip {
+			logln("  Skipped by user:", entry.path)
+			parms.Report.add(ReportEntry{Kind: ReportSkipped, Path: entry.path, Keep: keep.path, KeepRoot: keep.root, Size: entry.size})
+			return true, nil
+		}
+		if decision.Keep < 0 || decision.Keep >= len(keepers) {
+			return true, fmt.Errorf("invalid keeper %d for %s", decision.Keep, entry.path)
+		}
+		keep = keepers[decision.Keep]
+	}
+
+	// all names of the inode must go, otherwise no space is freed
+	if err := duplicateHandler(ctx, entry, *keep, parms, *strategy); err != nil {
+		return true, err
+	}
+	for _, name := range entry.hardlinks {
+		link := entry
+		link.path = name
+		link.name = filepath.Base(name)
+		if err := duplicateHandler(ctx, link, *keep, parms, *strategy); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// linked reports whether entry is already the same file as one of the targets
+func linked(entry FileEntry, targetEntries []FileEntry, parms ExecuteArgs) bool {
+	for _, targetEntry := range targetEntries {
+		// a followed symlink resolves to the inode of its referent, it is no hardlink
+		if entry.isSymlink {
+			if entry.SameFile(&targetEntry) {
+				logln("  Symlink to target:", entry.path)
+				return true
 			}
+			continue
+		}
+
+		// an existing hardlink frees no space, trashing it only breaks the link
+		if entry.SameInode(&targetEntry) {
+			logln("  Hardlink:", entry.path)
+			logln("    Target:", targetEntry.path)
+			parms.Report.add(ReportEntry{Kind: ReportHardlink, Path: entry.path, Keep: targetEntry.path, KeepRoot: targetEntry.root, Size: entry.size})
+			return true
+		}
+
+		// a symlink and its referent are the same file, not two copies
+		if entry.SameFile(&targetEntry) {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
-func (config_struct *Config) Execute(cmdLineArgs CmdLineArgs) error {
-	parms := ExecuteArgs{cmd: cmdLineArgs, config: *config_struct}
+/*
+Execute executes all strategies of the config. Once the context is done, the running strategy
+stops after the current file operation and the report of the finished operations is returned.
+*/
+func (config_struct *Config) Execute(ctx context.Context, cmdLineArgs CmdLineArgs) (*Report, error) {
+	report := new(Report)
 
-	for name, strategy := range config_struct.strategies {
-		fmt.Println("Execute:", name)
-		if err := strategy.Execute(parms); err != nil {
-			return err
+	for _, name := range config_struct.Strategies() {
+		strategyReport, err := config_struct.ExecuteStrategy(ctx, name, cmdLineArgs)
+		report.Strategies = append(report.Strategies, strategyReport)
+		report.Total = report.TotalStats()
+		if err != nil {
+			return report, err
 		}
 	}
-	return nil
+	return report, nil
+}
+
+// ExecuteStrategy executes a single strategy of the config by name
+func (config_struct *Config) ExecuteStrategy(ctx context.Context, name string, cmdLineArgs CmdLineArgs) (*StrategyReport, error) {
+	strategy, ok := config_struct.strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("strategy not found: %s", name)
+	}
+
+	logln("Execute:", name)
+	fsys := &hashingFS{FileSystem: fsOrDefault(config_struct.fsys)}
+	parms := ExecuteArgs{Cmd: cmdLineArgs, Config: *config_struct, FS: fsys, Decider: config_struct.decider}
+	parms.Report = &StrategyReport{Name: name, Stats: new(Stats)}
+	err := strategy.Execute(ctx, parms)
+
+	parms.Report.Stats.BytesHashed = fsys.bytesHashed()
+	parms.Report.Stats.addEntries(parms.Report.Entries)
+	return parms.Report, err
 }
@@ -0,0 +1,252 @@
+package file_cleaner
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+/*
+PathTemplate describes where a file goes, relative to the destination root.
+Fields are written in braces, e.g. `{year}/{month}/{name}`, the supported fields are
+  - `{year}`, `{month}`, `{day}` modification time of the file
+  - `{ext}` lower case extension without dot, `no_extension` if the file has none
+  - `{name}` file name, `{stem}` file name without extension
+  - `{hash8}` first 8 hex digits of the MD5 hash
+  - `{rule}` name of the rule that matched the file
+  - `{dir}` directory of the file relative to the source directory
+*/
+type PathTemplate struct {
+	raw   string
+	parts []templatePart
+}
+
+// templatePart is either a literal or a field
+type templatePart struct {
+	literal string
+	field   string
+}
+
+var templateFields = map[string]bool{
+	"year": true, "month": true, "day": true,
+	"ext": true, "name": true, "stem": true,
+	"hash8": true, "rule": true, "dir": true,
+}
+
+// TemplateFields are the values that do not come from the file itself
+type TemplateFields struct {
+	Rule string
+	Dir  string
+}
+
+// ParsePathTemplate parses and validates a path template
+func ParsePathTemplate(raw string) (*PathTemplate, error) {
+	template := &PathTemplate{raw: raw}
+	rest := raw
+	for rest != "" {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			template.parts = append(template.parts, templatePart{literal: rest})
+			break
+		}
+		if rest[start] == '}' {
+			return nil, fmt.Errorf("unexpected } in template: %s", raw)
+		}
+		if start > 0 {
+			template.parts = append(template.parts, templatePart{literal: rest[:start]})
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in template: %s", raw)
+		}
+		field := rest[start+1 : start+end]
+		if !templateFields[field] {
+			return nil, fmt.Errorf("unknown field {%s} in template: %s", field, raw)
+		}
+		template.parts = append(template.parts, templatePart{field: field})
+		rest = rest[start+end+1:]
+	}
+
+	if len(template.parts) == 0 {
+		return nil, errors.New("empty template")
+	}
+	if filepath.IsAbs(raw) {
+		return nil, fmt.Errorf("template must be relative: %s", raw)
+	}
+	return template, nil
+}
+
+// String returns the template as written in the config
+func (template *PathTemplate) String() string {
+	return template.raw
+}
+
+/*
+Expand returns the relative destination path of the entry.
+The result never leaves the destination root.
+*/
+func (template *PathTemplate) Expand(entry *FileEntry, fields TemplateFields) (string, error) {
+	var buf strings.Builder
+	for _, part := range template.parts {
+		if part.field == "" {
+			buf.WriteString(part.literal)
+			continue
+		}
+
+		value, err := template.field(part.field, entry, fields)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(value)
+	}
+
+	path := filepath.Clean(buf.String())
+	if path == "." || path == ".." || filepath.IsAbs(path) || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("template %s expands outside the destination: %s", template.raw, path)
+	}
+	return path, nil
+}
+
+// field returns the value of a single template field
+func (template *PathTemplate) field(field string, entry *FileEntry, fields TemplateFields) (string, error) {
+	switch field {
+	case "year":
+		return entry.modTime.Format("2006"), nil
+	case "month":
+		return entry.modTime.Format("01"), nil
+	case "day":
+		return entry.modTime.Format("02"), nil
+	case "ext":
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(entry.name)), ".")
+		if ext == "" {
+			ext = noExtensionDir
+		}
+		return ext, nil
+	case "name":
+		return entry.name, nil
+	case "stem":
+		return strings.TrimSuffix(entry.name, filepath.Ext(entry.name)), nil
+	case "hash8":
+		md5, err := entry.MD5()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", md5)[:8], nil
+	case "rule":
+		// the rule name is a single path element
+		if fields.Rule == "" {
+			return "unknown", nil
+		}
+		return strings.ReplaceAll(fields.Rule, string(filepath.Separator), "_"), nil
+	case "dir":
+		return fields.Dir, nil
+	}
+	return "", fmt.Errorf("unknown field {%s}", field)
+}
+
+// CollisionPolicy decides what happens if the destination already exists
+type CollisionPolicy string
+
+const (
+	// CollisionSkip leaves the file where it is, this is the default
+	CollisionSkip CollisionPolicy = "skip"
+	// CollisionSuffix appends a number to the name, e.g. `paper_1.pdf`
+	CollisionSuffix CollisionPolicy = "suffix"
+	// CollisionReplaceIfIdentical moves the existing file to trash if it has the same content, otherwise skip
+	CollisionReplaceIfIdentical CollisionPolicy = "replace_if_identical"
+)
+
+// maxCollisionSuffix limits the number of names tried by CollisionSuffix
+const maxCollisionSuffix = 1000
+
+/*
+Mover places files below a root directory using a path template and a collision policy,
+it is shared by the strategies that move files.
+*/
+type Mover struct {
+	root      string
+	template  *PathTemplate
+	collision CollisionPolicy
+}
+
+// NewMover creates a mover, the collision policy defaults to skip
+func NewMover(root string, template string, collision CollisionPolicy) (*Mover, error) {
+	parsed, err := ParsePathTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	if collision == "" {
+		collision = CollisionSkip
+	}
+	switch collision {
+	case CollisionSkip, CollisionSuffix, CollisionReplaceIfIdentical:
+	default:
+		return nil, fmt.Errorf("unknown collision policy: %s", collision)
+	}
+
+	return &Mover{root: root, template: parsed, collision: collision}, nil
+}
+
+// Root returns the destination root directory
+func (mover *Mover) Root() string {
+	return mover.root
+}
+
+// Destination returns the destination path of the entry before collisions are resolved
+func (mover *Mover) Destination(entry *FileEntry, fields TemplateFields) (string, error) {
+	rel, err := mover.template.Expand(entry, fields)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(mover.root, rel), nil
+}
+
+/*
+Resolve applies the collision policy to the destination, it is checked on the file system of the entry.
+taken reports destinations already planned in this run.
+It returns the final destination, replace is true if the existing file must be moved to trash first,
+ok is false if the file must be skipped.
+*/
+func (mover *Mover) Resolve(entry *FileEntry, destination string, taken func(string) bool) (final string, replace bool, ok bool) {
+	final, existing, ok := mover.resolve(entry, destination, taken)
+	return final, existing != nil, ok
+}
+
+// resolve is Resolve that returns the identical file to replace, it is nil if nothing is replaced
+func (mover *Mover) resolve(entry *FileEntry, destination string, taken func(string) bool) (final string, existing *FileEntry, ok bool) {
+	exists := func(path string) bool {
+		_, err := entry.fs().Lstat(FSName(path))
+		return err == nil || taken(path)
+	}
+
+	if !exists(destination) {
+		return destination, nil, true
+	}
+
+	switch mover.collision {
+	case CollisionSuffix:
+		ext := filepath.Ext(destination)
+		stem := strings.TrimSuffix(destination, ext)
+		for i := 1; i <= maxCollisionSuffix; i++ {
+			candidate := fmt.Sprintf("%s_%d%s", stem, i, ext)
+			if !exists(candidate) {
+				return candidate, nil, true
+			}
+		}
+	case CollisionReplaceIfIdentical:
+		if taken(destination) {
+			return destination, nil, false
+		}
+		existing = new(FileEntry)
+		if err := existing.LoadFS(entry.fs(), destination); err != nil || existing.isDir {
+			return destination, nil, false
+		}
+		if entry.Equal(existing) {
+			return destination, existing, true
+		}
+	}
+	return destination, nil, false
+}
@@ -0,0 +1,98 @@
+package file_cleaner
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+)
+
+// TrashSession is a trash directory of one run and the operations of its manifest
+type TrashSession struct {
+	Path    string           `json:"path"`
+	Records []ManifestRecord `json:"records"`
+}
+
+// TrashSessions lists the sessions below a `trash_dir` that have a manifest, the newest first
+func TrashSessions(fsys ReadFS, trashRoot string) ([]TrashSession, error) {
+	entries, err := fs.ReadDir(fsys, FSName(trashRoot))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sessions []TrashSession
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].IsDir() {
+			continue
+		}
+		path := filepath.Join(trashRoot, entries[i].Name())
+		records, err := ReadManifestFS(fsys, filepath.Join(path, ManifestName))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, TrashSession{Path: path, Records: records})
+	}
+	return sessions, nil
+}
+
+// originalPath returns the path a record changed, the path a restore brings back
+func originalPath(record ManifestRecord) string {
+	if record.Action == ManifestSymlink {
+		return record.To
+	}
+	return record.From
+}
+
+/*
+Restore undoes the operations of a trash session in reverse order, paths limits it to these
+original paths, all are restored if empty. A symlink is only removed if it still points to the kept file,
+a file is only moved back if it is still in the trash and nothing took its place.
+It returns the records that were undone, a failed record is reported and skipped.
+*/
+func Restore(fsys FileSystem, session string, paths []string) ([]ManifestRecord, error) {
+	fsys = fsOrDefault(fsys)
+	records, err := ReadManifestFS(fsys, filepath.Join(session, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, path := range paths {
+		wanted[path] = true
+	}
+
+	var restored []ManifestRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if len(wanted) > 0 && !wanted[originalPath(record)] {
+			continue
+		}
+
+		switch record.Action {
+		case ManifestSymlink:
+			if link, err := fsys.ReadLink(FSName(record.To)); err != nil || link != record.From {
+				continue
+			}
+			if err := fsys.Remove(FSName(record.To)); err != nil {
+				logln("  Error removing symlink:", record.To, err)
+				continue
+			}
+		case ManifestTrash, ManifestMove:
+			if _, err := fsys.Lstat(FSName(record.To)); err != nil {
+				continue
+			}
+			if err := moveFile(fsys, record.To, record.From); err != nil {
+				logln("  Error restoring:", record.From, err)
+				continue
+			}
+		default:
+			continue
+		}
+		logln("  Restored:", originalPath(record))
+		restored = append(restored, record)
+	}
+	return restored, nil
+}
@@ -1,7 +1,11 @@
 package file_cleaner
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -9,6 +13,63 @@ import (
 func Timer(name string) func() {
 	start := time.Now()
 	return func() {
-		fmt.Printf("Time elapsed for %s: %v\n", name, time.Since(start))
+		logf("Time elapsed for %s: %v\n", name, time.Since(start))
 	}
 }
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (reader *contextReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return reader.reader.Read(p)
+}
+
+// output receives all messages of the package, SetOutput changes it
+var (
+	outputMutex sync.Mutex
+	output      io.Writer = os.Stdout
+)
+
+/*
+SetOutput sets the destination of the progress messages printed by the package,
+the default is os.Stdout. Use io.Discard to silence the package and rely on the Report.
+*/
+func SetOutput(writer io.Writer) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	output = writer
+}
+
+// logln prints a message like fmt.Println to the package output
+func logln(a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Fprintln(output, a...)
+}
+
+// logf prints a message like fmt.Printf to the package output
+func logf(format string, a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Fprintf(output, format, a...)
+}
+
+// FormatSize formats a number of bytes for humans
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size), 0
+	for value >= unit*unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value/unit, "KMGTP"[exp])
+}
@@ -0,0 +1,333 @@
+package file_cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// partialSuffixes are files still being written by a browser or downloader, they are renamed when done
+var partialSuffixes = []string{".crdownload", ".part", ".partial", ".download", ".opdownload", ".tmp"}
+
+// targetIndex is the in-memory target index, the watch mode keeps it up to date
+type targetIndex struct {
+	sizeIndex map[int64]([]FileEntry)
+	fileMap   map[string]FileEntry
+}
+
+// add the entry to the index, an older entry of the same path is replaced
+func (index *targetIndex) add(entry FileEntry) {
+	index.removeFile(entry.path)
+	index.sizeIndex[entry.size] = append(index.sizeIndex[entry.size], entry)
+	index.fileMap[entry.path] = entry
+}
+
+// removeFile removes a single file from the index
+func (index *targetIndex) removeFile(path string) {
+	entry, ok := index.fileMap[path]
+	if !ok {
+		return
+	}
+
+	delete(index.fileMap, path)
+	entries := index.sizeIndex[entry.size]
+	for i := range entries {
+		if entries[i].path == path {
+			index.sizeIndex[entry.size] = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+}
+
+// remove the path from the index, if it is a directory all files below are removed
+func (index *targetIndex) remove(path string) {
+	if _, ok := index.fileMap[path]; ok {
+		index.removeFile(path)
+		return
+	}
+
+	prefix := path + string(filepath.Separator)
+	for filePath := range index.fileMap {
+		if strings.HasPrefix(filePath, prefix) {
+			index.removeFile(filePath)
+		}
+	}
+}
+
+// watchedStrategy is the state of one strategy in watch mode
+type watchedStrategy struct {
+	strategy *SourceToTargetDedupeStrategy
+	index    targetIndex
+	parms    ExecuteArgs
+	planned  map[string]bool
+}
+
+// pendingFile is a new source file waiting until it is stable
+type pendingFile struct {
+	strategy  *watchedStrategy
+	source    DirEntry
+	lastEvent time.Time
+	checked   bool
+	size      int64
+	modTime   time.Time
+}
+
+// dirEntryOf returns the dir entry the path belongs to
+func dirEntryOf(dirs []DirEntry, path string) (DirEntry, bool) {
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir.path, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if !dir.recursively && strings.ContainsRune(rel, filepath.Separator) {
+			continue
+		}
+		return dir, true
+	}
+	return DirEntry{}, false
+}
+
+// isPartial returns true if the file is a partial download
+func isPartial(path string) bool {
+	for _, suffix := range partialSuffixes {
+		if strings.HasSuffix(strings.ToLower(path), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWatchedEntry loads a single file the way ListFiles would, ok is false if it is not a candidate
+func loadWatchedEntry(dirEntry DirEntry, path string) (entry FileEntry, ok bool) {
+	if !dirEntry.Match(path) {
+		return entry, false
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil || info.IsDir() {
+		return entry, false
+	}
+	if info.Mode()&os.ModeSymlink != 0 && dirEntry.symlinks != SymlinkFollow {
+		return entry, false
+	}
+
+	if err := entry.Load(path); err != nil || entry.isDir {
+		return entry, false
+	}
+	entry.root = dirEntry.path
+	return entry, true
+}
+
+// addWatchRecursive watches the directory and, if recursive, all directories below
+func addWatchRecursive(watcher *fsnotify.Watcher, path string, recursively bool) error {
+	if !recursively {
+		return watcher.Add(path)
+	}
+
+	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+/*
+Watch watches the source directories of each `source_to_target_dedupe` strategy and processes new files
+until the context is done. New files are handled after no event was seen for debounce and their size and
+modification time did not change. The target index is built once and kept up to date from target events.
+*/
+func (config_struct *Config) Watch(ctx context.Context, cmdLineArgs CmdLineArgs, debounce time.Duration) (*Report, error) {
+	report := new(Report)
+	if debounce <= 0 {
+		return report, errors.New("debounce must be positive")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return report, err
+	}
+	defer watcher.Close()
+
+	var strategies []*watchedStrategy
+	for name, strategy := range config_struct.strategies {
+		dedupe, ok := strategy.(*SourceToTargetDedupeStrategy)
+		if !ok {
+			logln("Watch mode does not support strategy:", name)
+			continue
+		}
+
+		if err := dedupe.checkIndependent(); err != nil {
+			return report, err
+		}
+
+		logln("Watch:", name)
+		dedupe.newTrashSession()
+		logln("Trash Path:", dedupe.trashPath)
+		sizeIndex, fileMap, err := dedupe.indexTargets(ctx, OSFS{})
+		if err != nil {
+			return report, err
+		}
+
+		watched := &watchedStrategy{
+			strategy: dedupe,
+			index:    targetIndex{sizeIndex: sizeIndex, fileMap: fileMap},
+			parms:    ExecuteArgs{Cmd: cmdLineArgs, Config: *config_struct},
+			planned:  make(map[string]bool),
+		}
+		watched.parms.Report = &StrategyReport{Name: name, Strategy: dedupe.super.strategy, TrashDir: dedupe.trashPath, Verify: string(dedupe.verify)}
+		watched.parms.Manifest = NewManifest(dedupe.trashPath)
+		defer watched.parms.Manifest.Close()
+		report.Strategies = append(report.Strategies, watched.parms.Report)
+		strategies = append(strategies, watched)
+
+		for _, dir := range append(append([]DirEntry{}, dedupe.targets...), dedupe.source...) {
+			if err := addWatchRecursive(watcher, dir.path, dir.recursively); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	pending := make(map[string]*pendingFile)
+	ticker := time.NewTicker(debounce / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return report, nil
+		case err := <-watcher.Errors:
+			logln("Watch error:", err)
+		case event := <-watcher.Events:
+			for _, watched := range strategies {
+				watched.handleEvent(watcher, event, pending)
+			}
+		case now := <-ticker.C:
+			for path, file := range pending {
+				if now.Sub(file.lastEvent) < debounce {
+					continue
+				}
+
+				info, err := os.Lstat(path)
+				if err != nil || isPartial(path) {
+					delete(pending, path)
+					continue
+				}
+
+				// the file must keep the same size and modification time for another debounce period
+				if !file.checked || info.Size() != file.size || !info.ModTime().Equal(file.modTime) {
+					file.checked = true
+					file.size = info.Size()
+					file.modTime = info.ModTime()
+					file.lastEvent = now
+					continue
+				}
+
+				delete(pending, path)
+				if err := file.strategy.process(ctx, file.source, path); err != nil {
+					// a done context ends the watch like the case above, any other error is returned
+					if ctx.Err() != nil {
+						return report, nil
+					}
+					return report, fmt.Errorf("%s: %w", path, err)
+				}
+			}
+		}
+	}
+}
+
+// handleEvent updates the target index or queues a new source file
+func (watched *watchedStrategy) handleEvent(watcher *fsnotify.Watcher, event fsnotify.Event, pending map[string]*pendingFile) {
+	path := event.Name
+	created := event.Op&(fsnotify.Create|fsnotify.Write) != 0
+	removed := event.Op&(fsnotify.Remove|fsnotify.Rename) != 0
+
+	if target, ok := dirEntryOf(watched.strategy.targets, path); ok {
+		if removed {
+			watched.index.remove(path)
+		}
+		if !created {
+			return
+		}
+
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			// a new directory, index the files moved in with it
+			if target.recursively {
+				addWatchRecursive(watcher, path, true)
+				dir := target
+				dir.path = path
+				_, fileMap := ListFiles(dir)
+				for _, entry := range fileMap {
+					entry.root = target.path
+					watched.index.add(entry)
+				}
+			}
+			return
+		}
+
+		if entry, ok := loadWatchedEntry(target, path); ok {
+			watched.index.add(entry)
+		}
+		return
+	}
+
+	source, ok := dirEntryOf(watched.strategy.source, path)
+	if !ok {
+		return
+	}
+	if removed {
+		delete(pending, path)
+	}
+	if !created {
+		return
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		// a new directory, queue the files moved in with it
+		if source.recursively {
+			addWatchRecursive(watcher, path, true)
+			dir := source
+			dir.path = path
+			_, fileMap := ListFiles(dir)
+			for filePath := range fileMap {
+				pending[filePath] = &pendingFile{strategy: watched, source: source, lastEvent: time.Now()}
+			}
+		}
+		return
+	}
+
+	if file, ok := pending[path]; ok {
+		file.lastEvent = time.Now()
+		return
+	}
+	pending[path] = &pendingFile{strategy: watched, source: source, lastEvent: time.Now()}
+}
+
+// process a stable source file against the target index, the error is set if the context is done or the file can not be handled
+func (watched *watchedStrategy) process(ctx context.Context, source DirEntry, path string) error {
+	entry, ok := loadWatchedEntry(source, path)
+	if !ok {
+		return nil
+	}
+
+	logln("New file:", path)
+	handled, err := watched.strategy.dedupeEntry(ctx, entry, watched.index.sizeIndex, watched.parms)
+	if err != nil || handled || watched.strategy.ingest == nil {
+		return err
+	}
+
+	moved, ok, err := ingestHandler(ctx, entry, source, watched.parms, *watched.strategy, watched.planned)
+	if ok {
+		watched.index.add(moved)
+	}
+	return err
+}
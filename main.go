@@ -1,71 +1,604 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
-
-	"github.com/gofrs/flock"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/r888800009/file_cleaner/tui"
+	"github.com/r888800009/file_cleaner/web"
 )
 
-func parseArgs() (config *file_cleaner.Config, cmdArgs *file_cleaner.CmdLineArgs, err error) {
+// cliArgs are the flags shared by the subcommands
+type cliArgs struct {
+	configPath string
+	cmd        file_cleaner.CmdLineArgs
+	lock       file_cleaner.LockOptions
+}
+
+/*
+parseRunArgs defines the flags of a run on flags and parses args,
+subcommands define their own flags before calling it.
+*/
+func parseRunArgs(flags *flag.FlagSet, args []string) *cliArgs {
 	// Define flags
-	var configPath = flag.String("config", "", "Path to the configuration file")
-	var dryRun = flag.Bool("dry-run", true, "Run the program in dry-run mode (no changes will be made)")
-	var replaceAsSymlink = flag.Bool("replace-as-symlink", false, "Replace duplicate files with symlinks and move to trash")
-	flag.Parse()
+	var dryRun = flags.Bool("dry-run", true, "Run the program in dry-run mode (no changes will be made)")
+	var replaceAsSymlink = flags.Bool("replace-as-symlink", false, "Replace duplicate files with symlinks and move to trash")
+	var lockDir = flags.String("lock-dir", file_cleaner.DefaultLockDir(), "Directory of the lock files")
+	var lockWait = flags.Duration("lock-wait", 0, "Wait up to this duration if another instance holds the lock")
+	flags.Parse(args)
+
+	parsed := new(cliArgs)
+	parsed.lock = file_cleaner.LockOptions{Dir: *lockDir, Wait: *lockWait}
+	parsed.cmd.DryRun = *dryRun
+	parsed.cmd.ReplaceAsSymlink = *replaceAsSymlink
+	return parsed
+}
+
+// printMode prints the mode of the run
+func (parsed *cliArgs) printMode() {
+	if parsed.cmd.DryRun {
+		fmt.Println("Running in dry-run mode")
+	}
+	if parsed.cmd.ReplaceAsSymlink {
+		fmt.Println("Replacing duplicate files with symlinks and moving to trash")
+	}
+}
+
+// parseArgs is parseRunArgs with the required -config flag
+func parseArgs(flags *flag.FlagSet, args []string) (*cliArgs, error) {
+	var configPath = flags.String("config", "", "Path to the configuration file")
+	parsed := parseRunArgs(flags, args)
 
 	if *configPath == "" {
-		return nil, nil, errors.New("please provide a configuration file")
+		return nil, errors.New("please provide a configuration file")
 	}
+	parsed.configPath = *configPath
+	parsed.printMode()
+	return parsed, nil
+}
 
-	cmdArgs = new(file_cleaner.CmdLineArgs)
-	cmdArgs.DryRun = *dryRun
-	if *dryRun {
-		fmt.Println("Running in dry-run mode")
+// loadConfig loads the configuration file or exits
+func loadConfig(path string) *file_cleaner.Config {
+	config := new(file_cleaner.Config)
+	if err := config.Load(path); err != nil {
+		fmt.Println("Error loading configuration file:", err)
+		os.Exit(1)
 	}
+	return config
+}
 
-	cmdArgs.ReplaceAsSymlink = *replaceAsSymlink
-	if *replaceAsSymlink {
-		fmt.Println("Replacing duplicate files with symlinks and moving to trash")
+// withLock runs fn only if no other instance of file_cleaner is running with the same config or trash roots
+func withLock(args *cliArgs, trashRoots []string, fn func() error) {
+	unlock, err := lockRun(args, trashRoots)
+	if err == file_cleaner.ErrLocked {
+		fmt.Println("Another instance of file_cleaner is already running")
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Println("Error locking file:", err)
+		os.Exit(1)
 	}
 
-	config = new(file_cleaner.Config)
-	err = config.Load(*configPath)
+	err = fn()
+	unlock()
 	if err != nil {
-		fmt.Println("Error loading configuration file:", err)
-		return nil, nil, err
+		os.Exit(1)
+	}
+}
+
+// lockRun takes the lock of the config file if there is one, then the lock of each trash root
+func lockRun(args *cliArgs, trashRoots []string) (func(), error) {
+	unlockConfig := func() {}
+	if args.configPath != "" {
+		var err error
+		if unlockConfig, err = file_cleaner.Lock(args.configPath, args.lock); err != nil {
+			return nil, err
+		}
 	}
 
-	return config, cmdArgs, nil
+	unlockTrash, err := file_cleaner.LockTrash(trashRoots, args.lock)
+	if err != nil {
+		unlockConfig()
+		return nil, err
+	}
+	return func() {
+		unlockTrash()
+		unlockConfig()
+	}, nil
 }
 
-func main() {
-	config, cmdArgs, err := parseArgs()
+/*
+interruptContext returns a context that is done on the first SIGINT or SIGTERM,
+the running operation is finished and the summary printed. A second signal aborts at once.
+*/
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+		fmt.Println("Interrupted, finishing the current operation, press Ctrl-C again to abort")
+		cancel()
+
+		<-signals
+		fmt.Println("Aborted")
+		os.Exit(130)
+	}()
+	return ctx, cancel
+}
+
+// watch runs the watch mode until SIGINT or SIGTERM
+func watch(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	var debounce = flags.Duration("debounce", 2*time.Second, "Wait until a new file is unchanged for this duration")
+	parsed, err := parseArgs(flags, args)
 	if err != nil {
 		fmt.Println("Error parsing arguments:", err)
 		os.Exit(1)
 	}
+	config := loadConfig(parsed.configPath)
+
+	withLock(parsed, config.TrashRoots(), func() error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		report, err := config.Watch(ctx, parsed.cmd, *debounce)
+		if err != nil {
+			fmt.Println("Error watching configuration:", err)
+			return err
+		}
+		report.Print()
+		return nil
+	})
+}
 
-	lock_file := flock.New("/tmp/file_cleaner.lock")
-	locked, err := lock_file.TryLock()
+// daemon runs the scheduled strategies until SIGINT or SIGTERM, SIGHUP reloads the config
+func daemon(args []string) {
+	parsed, err := parseArgs(flag.NewFlagSet("daemon", flag.ExitOnError), args)
 	if err != nil {
-		fmt.Println("Error locking file:", err)
+		fmt.Println("Error parsing arguments:", err)
 		os.Exit(1)
 	}
 
-	if locked {
-		if err = config.Execute(*cmdArgs); err != nil {
-			fmt.Println("Error executing configuration:", err)
+	ctx, stop := interruptContext()
+	defer stop()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	if err := file_cleaner.RunDaemon(ctx, parsed.configPath, parsed.cmd, parsed.lock, reload); err != nil {
+		fmt.Println("Error running daemon:", err)
+		os.Exit(1)
+	}
+}
+
+// status reports the lock files and the instances holding them
+func status(args []string) {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	var lockDir = flags.String("lock-dir", file_cleaner.DefaultLockDir(), "Directory of the lock files")
+	flags.Parse(args)
+
+	states, err := file_cleaner.LockStatus(*lockDir)
+	if err != nil {
+		fmt.Println("Error reading lock files:", err)
+		os.Exit(1)
+	}
+
+	if len(states) == 0 {
+		fmt.Println("No lock files in", *lockDir)
+	}
+	for _, state := range states {
+		if !state.Held {
+			fmt.Println("Free:", state.Path)
+		} else if state.Info == nil {
+			fmt.Println("Held:", state.Path)
+		} else {
+			// a trash lock is taken by every run, with or without a config file
+			owner := "Config: " + state.Info.Config
+			if state.Info.Trash != "" {
+				owner = "Trash: " + state.Info.Trash
+			}
+			fmt.Println("Held:", state.Path, "PID:", state.Info.PID, "Since:", state.Info.StartTime.Format(time.RFC3339), owner)
+		}
+	}
+}
+
+/*
+review opens the TUI on a saved plan, or on a plan made of a saved report.
+The plan is applied after the TUI is closed with apply, the trash roots of the plan are locked while it runs.
+*/
+func review(args []string) {
+	flags := flag.NewFlagSet("tui", flag.ExitOnError)
+	var reportPath = flags.String("report", "", "Report of a dry run saved by -report")
+	var planPath = flags.String("plan", "plan.json", "Plan file, it is loaded if -report is not given and saved by w")
+	parsed := parseRunArgs(flags, args)
+
+	var plan *file_cleaner.Plan
+	var err error
+	if *reportPath != "" {
+		// a saved plan may be older than the report, the user has to pick one
+		if _, statErr := os.Stat(*planPath); statErr == nil {
+			fmt.Println("Error loading plan: both", *reportPath, "and", *planPath, "exist, remove the plan or omit -report to resume it")
 			os.Exit(1)
 		}
 
-		lock_file.Unlock()
+		var report *file_cleaner.Report
+		report, err = file_cleaner.LoadReport(*reportPath)
+		if err == nil {
+			plan = file_cleaner.NewPlan(report)
+		}
 	} else {
-		fmt.Println("Another instance of file_cleaner is already running")
+		plan, err = file_cleaner.LoadPlan(*planPath)
+	}
+	if err != nil {
+		fmt.Println("Error loading plan:", err)
+		os.Exit(1)
+	}
+
+	apply, err := tui.Run(plan, *planPath)
+	if err != nil {
+		fmt.Println("Error running tui:", err)
+		os.Exit(1)
+	}
+	if !apply {
+		return
+	}
+
+	// a run of a config or the daemon may move files to the same trash
+	parsed.printMode()
+	withLock(parsed, plan.TrashRoots(), func() error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		strategyReport, err := plan.Apply(ctx, nil, parsed.cmd)
+		(&file_cleaner.Report{Strategies: []*file_cleaner.StrategyReport{strategyReport}}).Print()
+		if err != nil {
+			fmt.Println("Error applying plan:", err)
+			return err
+		}
+		return nil
+	})
+}
+
+/*
+serve runs the web UI and the JSON API on the loopback interface until SIGINT or SIGTERM.
+-dry-run applies to the apply action, a scan never changes anything.
+*/
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	var listen = flags.String("listen", "127.0.0.1:8080", "Loopback address of the web UI")
+	var planPath = flags.String("plan", "", "Plan file, it is loaded if it exists and saved after each change")
+	parsed, err := parseArgs(flags, args)
+	if err != nil {
+		fmt.Println("Error parsing arguments:", err)
+		os.Exit(1)
+	}
+	config := loadConfig(parsed.configPath)
+
+	var plan *file_cleaner.Plan
+	if *planPath != "" {
+		plan, err = file_cleaner.LoadPlan(*planPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Println("Error loading plan:", err)
+			os.Exit(1)
+		}
+	}
+
+	listener, err := web.Listen(*listen)
+	if err != nil {
+		fmt.Println("Error listening:", err)
+		os.Exit(1)
+	}
+
+	withLock(parsed, config.TrashRoots(), func() error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		server := &http.Server{Handler: web.New(config, parsed.cmd, plan, *planPath).Handler()}
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		fmt.Println("Serving on http://" + listener.Addr().String())
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			fmt.Println("Error serving:", err)
+			return err
+		}
+		return nil
+	})
+}
+
+/*
+scan reports the duplicates of the paths on the command line, no config file is needed
+and nothing is moved. The output is the fdupes format or JSON.
+*/
+func scan(args []string) {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	var recursive = flags.Bool("recursive", true, "List sub directories")
+	var ignore = flags.String("ignore", "", "Go regex of paths that are not listed")
+	var followSymlinks = flags.Bool("follow-symlinks", false, "Follow symbolic links instead of skipping them")
+	var showSize = flags.Bool("size", false, "Show the size of each set like fdupes -S")
+	var asJSON = flags.Bool("json", false, "Print the duplicate sets as JSON")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("Usage: file_cleaner scan [flags] path...")
+		os.Exit(1)
+	}
+
+	var dirs []file_cleaner.DirEntry
+	for _, path := range flags.Args() {
+		dir := file_cleaner.NewDirEntry(path, *recursive)
+		if err := dir.SetIgnore(*ignore); err != nil {
+			fmt.Println("Error parsing ignore:", err)
+			os.Exit(1)
+		}
+		if *followSymlinks {
+			dir.SetSymlinkPolicy(file_cleaner.SymlinkFollow)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	// the progress messages go to stderr, so the output can be parsed
+	file_cleaner.SetOutput(os.Stderr)
+	ctx, stop := interruptContext()
+	defer stop()
+
+	sets, err := file_cleaner.FindDuplicates(ctx, file_cleaner.OSFS{}, dirs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error scanning:", err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		if sets == nil {
+			sets = []file_cleaner.DuplicateSet{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(sets)
+	} else {
+		err = file_cleaner.WriteFdupes(os.Stdout, sets, *showSize)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing output:", err)
+		os.Exit(1)
+	}
+}
+
+// strategies lists the registered strategy types and their config keys
+func strategies(args []string) {
+	flags := flag.NewFlagSet("strategies", flag.ExitOnError)
+	flags.Parse(args)
+
+	for _, info := range file_cleaner.RegisteredStrategies() {
+		fmt.Println(info.Name)
+		fmt.Println("  " + info.Description)
+		for _, field := range info.Schema {
+			required := ""
+			if field.Required {
+				required = ", required"
+			}
+			fmt.Printf("    %s (%s%s): %s\n", field.Key, field.Type, required, field.Description)
+		}
+	}
+}
+
+// saveScript writes the actions of the report as an executable shell script
+func saveScript(report *file_cleaner.Report, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteScript(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// runOptions are the flags of a one-shot run
+type runOptions struct {
+	interactive *bool
+	reportPath  *string
+	scriptPath  *string
+}
+
+// defineRunOptions defines the flags of a one-shot run on flags
+func defineRunOptions(flags *flag.FlagSet) runOptions {
+	return runOptions{
+		interactive: flags.Bool("interactive", false, "Confirm each duplicate group before it is moved to trash"),
+		reportPath:  flags.String("report", "", "Save the report as JSON, the tui subcommand reviews the report of a dry run"),
+		scriptPath:  flags.String("script", "", "Save the actions as a shell script, usually of a dry run"),
+	}
+}
+
+// run executes all strategies of the config once
+func run(config *file_cleaner.Config, parsed *cliArgs, options runOptions) {
+	if *options.interactive {
+		config.SetDecider(file_cleaner.NewPromptDecider(os.Stdin, os.Stdout))
+	}
+
+	withLock(parsed, config.TrashRoots(), func() error {
+		ctx, stop := interruptContext()
+		defer stop()
+
+		report, err := config.Execute(ctx, parsed.cmd)
+		report.Print()
+		if *options.reportPath != "" {
+			if err := report.Save(*options.reportPath); err != nil {
+				fmt.Println("Error saving report:", err)
+			}
+		}
+		if *options.scriptPath != "" {
+			if err := saveScript(report, *options.scriptPath); err != nil {
+				fmt.Println("Error saving script:", err)
+			}
+		}
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted, the trash manifest lists the finished operations")
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Println("Error executing configuration:", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// absDir returns the absolute path of a directory flag, NewDirEntry expands ~
+func absDir(path string) (string, error) {
+	dir := file_cleaner.NewDirEntry(path, false)
+	return filepath.Abs(dir.Path())
+}
+
+// dirEntries creates the dir entries of the paths with absolute paths, so a printed config works from any directory
+func dirEntries(paths []string, recursive bool, ignore string) ([]file_cleaner.DirEntry, error) {
+	var dirs []file_cleaner.DirEntry
+	for _, path := range paths {
+		abs, err := absDir(path)
+		if err != nil {
+			return nil, err
+		}
+		dir := file_cleaner.NewDirEntry(abs, recursive)
+		if err := dir.SetIgnore(ignore); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+/*
+dedupe runs a source_to_target_dedupe strategy made of flags, no config file is needed.
+-print-config prints the equivalent config file instead. There is no config file to lock,
+only the trash directory is locked, as it is by a run of a config with the same `trash_dir`.
+*/
+func dedupe(args []string) {
+	flags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	var targets, sources stringList
+	flags.Var(&targets, "target", "Directory of the files to keep, can be repeated")
+	flags.Var(&sources, "source", "Directory to remove the duplicates from, can be repeated")
+	var trash = flags.String("trash", "", "Trash directory, each run moves files to its own session in it")
+	var ignore = flags.String("ignore", "", "Go regex of paths that are not listed, in targets and sources")
+	var recursive = flags.Bool("recursive", true, "List sub directories")
+	var verify = flags.String("verify", string(file_cleaner.VerifyHashBytes), "How duplicates are confirmed: size+hash, hash+bytes or paranoid")
+	var printConfig = flags.Bool("print-config", false, "Print the equivalent config file and exit")
+	options := defineRunOptions(flags)
+	parsed := parseRunArgs(flags, args)
+
+	strategy, err := dedupeStrategy(targets, sources, *trash, *ignore, *recursive, *verify)
+	if err != nil {
+		fmt.Println("Error parsing arguments:", err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		data, err := json.MarshalIndent(map[string]interface{}{"version": "0.1", "dedupe": strategy.Value()}, "", "    ")
+		if err != nil {
+			fmt.Println("Error printing config:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	config := file_cleaner.NewConfig()
+	if err := config.AddStrategy("dedupe", strategy); err != nil {
+		fmt.Println("Error creating config:", err)
+		os.Exit(1)
+	}
+	parsed.printMode()
+	run(config, parsed, options)
+}
+
+// dedupeStrategy creates the strategy of the dedupe flags
+func dedupeStrategy(targets []string, sources []string, trash string, ignore string, recursive bool, verify string) (*file_cleaner.SourceToTargetDedupeStrategy, error) {
+	targetDirs, err := dirEntries(targets, recursive, ignore)
+	if err != nil {
+		return nil, err
+	}
+	sourceDirs, err := dirEntries(sources, recursive, ignore)
+	if err != nil {
+		return nil, err
+	}
+	if trash != "" {
+		if trash, err = absDir(trash); err != nil {
+			return nil, err
+		}
+	}
+
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("dedupe", targetDirs, sourceDirs, trash)
+	if err != nil {
+		return nil, err
+	}
+	return strategy, strategy.SetVerify(file_cleaner.VerifyMode(verify))
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "watch":
+			watch(os.Args[2:])
+			return
+		case "daemon":
+			daemon(os.Args[2:])
+			return
+		case "status":
+			status(os.Args[2:])
+			return
+		case "strategies":
+			strategies(os.Args[2:])
+			return
+		case "tui":
+			review(os.Args[2:])
+			return
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "scan":
+			scan(os.Args[2:])
+			return
+		case "dedupe":
+			dedupe(os.Args[2:])
+			return
+		}
+	}
+
+	options := defineRunOptions(flag.CommandLine)
+	parsed, err := parseArgs(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Println("Error parsing arguments:", err)
 		os.Exit(1)
 	}
+	run(loadConfig(parsed.configPath), parsed, options)
 }
@@ -0,0 +1,113 @@
+package file_cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// test a config built in code without a config file
+func TestConfigBuiltInCode(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	dir := t.TempDir()
+	now := time.Now()
+	writeTestFile(t, filepath.Join(dir, "target", "a.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dir, "source", "copy.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dir, "source", "unique.txt"), "unique", now)
+
+	target := file_cleaner.NewDirEntry(filepath.Join(dir, "target"), true)
+	source := file_cleaner.NewDirEntry(filepath.Join(dir, "source"), true)
+	assert.Nil(source.SetIgnore(`\.part$`))
+	assert.NotNil(source.SetMatch("("))
+
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, filepath.Join(dir, "trash"))
+	assert.Nil(err)
+	_, err = file_cleaner.NewSourceToTargetDedupeStrategy("test", nil, []file_cleaner.DirEntry{source}, filepath.Join(dir, "trash"))
+	assert.NotNil(err)
+
+	config := file_cleaner.NewConfig()
+	assert.Nil(config.AddStrategy("test", strategy))
+	assert.NotNil(config.AddStrategy("test", strategy))
+	assert.Equal([]string{"test"}, config.Strategies())
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: false})
+	assert.Nil(err)
+	assert.Len(report.Strategies, 1)
+	assert.Equal(1, report.Strategies[0].Count(file_cleaner.ReportDuplicate))
+
+	entry := report.Strategies[0].Entries[0]
+	assert.Equal(filepath.Join(dir, "source", "copy.txt"), entry.Path)
+	assert.Equal(filepath.Join(dir, "target", "a.txt"), entry.Keep)
+	assert.FileExists(entry.TrashPath)
+	assert.NoFileExists(entry.Path)
+	assert.FileExists(filepath.Join(dir, "source", "unique.txt"))
+
+	// the manifest of the trash session lists the move
+	records, err := file_cleaner.ReadManifest(filepath.Join(report.Strategies[0].TrashDir, file_cleaner.ManifestName))
+	assert.Nil(err)
+	assert.Len(records, 1)
+	assert.Equal(file_cleaner.ManifestTrash, records[0].Action)
+}
+
+// a source inside a target is an error, not a panic
+func TestExecuteOverlap(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "target", "source", "copy.txt"), "same", time.Now())
+
+	target := file_cleaner.NewDirEntry(filepath.Join(dir, "target"), true)
+	source := file_cleaner.NewDirEntry(filepath.Join(dir, "target", "source"), true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, filepath.Join(dir, "trash"))
+	assert.Nil(err)
+	config := file_cleaner.NewConfig()
+	config.AddStrategy("test", strategy)
+
+	assert.NotPanics(func() {
+		_, err = config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: false})
+	})
+	assert.ErrorContains(err, "overlaps target")
+	assert.FileExists(filepath.Join(dir, "target", "source", "copy.txt"))
+}
+
+// test the config entry of a strategy built in code is loaded back as the same strategy
+func TestStrategyValue(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	target := file_cleaner.NewDirEntry("/data/target", true)
+	assert.Nil(target.SetIgnore(`\.git/`))
+	source := file_cleaner.NewDirEntry("/data/source", false)
+	assert.Nil(source.SetMatch(`\.pdf$`))
+	assert.Nil(source.SetSymlinkPolicy(file_cleaner.SymlinkFollow))
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/data/trash")
+	assert.Nil(err)
+	assert.Nil(strategy.SetVerify(file_cleaner.VerifyParanoid))
+
+	value := strategy.Value()
+	assert.Equal("/data/trash", value["trash_dir"])
+	assert.Equal("paranoid", value["verify"])
+	assert.Equal(map[string]interface{}{"path": "/data/target", "recursive": true, "ignore": `\.git/`}, value["target_dir"])
+
+	// the value survives a config file
+	data, err := json.Marshal(value)
+	assert.Nil(err)
+	var loaded map[string]interface{}
+	assert.Nil(json.Unmarshal(data, &loaded))
+	reloaded := new(file_cleaner.SourceToTargetDedupeStrategy)
+	assert.Nil(reloaded.Load("test", loaded))
+	assert.Equal(value, reloaded.Value())
+}
@@ -0,0 +1,150 @@
+package file_cleaner
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+)
+
+// the size of the synthetic trees, e.g. go test ./tests -run XXX -bench . -args -bench.files 10000
+var (
+	benchFiles     = flag.Int("bench.files", 200, "Number of files in the target and in the source tree")
+	benchSize      = flag.Int("bench.size", 64*1024, "Size of each file in bytes")
+	benchDuplicate = flag.Float64("bench.duplicate", 0.5, "Ratio of source files that duplicate a target file")
+)
+
+// benchFilesPerDir spreads the files over nested directories
+const benchFilesPerDir = 100
+
+// benchTree is a synthetic target and source tree
+type benchTree struct {
+	root   string
+	target file_cleaner.DirEntry
+	source file_cleaner.DirEntry
+}
+
+// benchDuplicates returns the number of source files that duplicate a target file
+func benchDuplicates() int {
+	return int(float64(*benchFiles) * *benchDuplicate)
+}
+
+/*
+newBenchTree writes the trees of the -bench flags, the content is random but the same for every run.
+The first duplicate ratio of the source files are copies of target files, the others are unique.
+*/
+func newBenchTree(b *testing.B) benchTree {
+	b.Helper()
+	root := b.TempDir()
+	random := rand.New(rand.NewSource(1))
+	duplicates := benchDuplicates()
+
+	write := func(tree string, i int, content []byte) {
+		path := filepath.Join(root, tree, fmt.Sprintf("dir%d", i/benchFilesPerDir), fmt.Sprintf("file%d.bin", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for i := 0; i < *benchFiles; i++ {
+		content := make([]byte, *benchSize)
+		random.Read(content)
+		write("target", i, content)
+		if i < duplicates {
+			write("source", i, content)
+		}
+	}
+	for i := duplicates; i < *benchFiles; i++ {
+		content := make([]byte, *benchSize)
+		random.Read(content)
+		write("source", i, content)
+	}
+
+	return benchTree{
+		root:   root,
+		target: file_cleaner.CreateDirEntry(filepath.Join(root, "target"), true),
+		source: file_cleaner.CreateDirEntry(filepath.Join(root, "source"), true),
+	}
+}
+
+func BenchmarkListFiles(b *testing.B) {
+	tree := newBenchTree(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		file_cleaner.ListFiles(tree.target)
+	}
+}
+
+func BenchmarkMD5(b *testing.B) {
+	tree := newBenchTree(b)
+	path := filepath.Join(tree.root, "target", "dir0", "file0.bin")
+	b.SetBytes(int64(*benchSize))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// a new entry, the hash is cached by the entry
+		var entry file_cleaner.FileEntry
+		if err := entry.Load(path); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := entry.MD5(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompare(b *testing.B) {
+	if benchDuplicates() == 0 {
+		b.Skip("no duplicate files, increase -bench.duplicate")
+	}
+	tree := newBenchTree(b)
+	b.SetBytes(int64(*benchSize) * 2)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var entry, other file_cleaner.FileEntry
+		if err := entry.Load(filepath.Join(tree.root, "target", "dir0", "file0.bin")); err != nil {
+			b.Fatal(err)
+		}
+		if err := other.Load(filepath.Join(tree.root, "source", "dir0", "file0.bin")); err != nil {
+			b.Fatal(err)
+		}
+		if !entry.Compare(&other) {
+			b.Fatal("the files are not equal")
+		}
+	}
+}
+
+// BenchmarkExecute runs the full dedupe in dry-run mode, so every iteration sees the same tree
+func BenchmarkExecute(b *testing.B) {
+	tree := newBenchTree(b)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("bench", []file_cleaner.DirEntry{tree.target}, []file_cleaner.DirEntry{tree.source}, filepath.Join(tree.root, "trash"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	config := file_cleaner.NewConfig()
+	if err := config.AddStrategy("bench", strategy); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(*benchFiles) * int64(*benchSize) * 2)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package file_cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeDaemonConfig writes one dedupe strategy per name, dir/<name>/source against dir/<name>/target
+func writeDaemonConfig(t *testing.T, dir string, schedules map[string]string) string {
+	config := map[string]interface{}{"version": "0.1"}
+	for name, schedule := range schedules {
+		strategy := map[string]interface{}{
+			"strategy":   "source_to_target_dedupe",
+			"target_dir": map[string]interface{}{"path": filepath.Join(dir, name, "target"), "recursive": true},
+			"trash_dir":  filepath.Join(dir, "trash"),
+			"source_dirs": []interface{}{
+				map[string]interface{}{"path": filepath.Join(dir, name, "source"), "recursive": true},
+			},
+		}
+		if schedule != "" {
+			strategy["schedule"] = schedule
+		}
+		config[name] = strategy
+
+		writeIngestFile(t, filepath.Join(dir, name, "target", "paper.pdf"), "paper")
+		writeIngestFile(t, filepath.Join(dir, name, "source", "paper.pdf"), "paper")
+	}
+
+	data, err := json.Marshal(config)
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "config.json")
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// startDaemon runs RunDaemon in the background, the returned function stops it and returns its error
+func startDaemon(t *testing.T, dir string, configPath string, reload chan os.Signal) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- file_cleaner.RunDaemon(ctx, configPath, file_cleaner.CmdLineArgs{}, file_cleaner.LockOptions{Dir: dir}, reload)
+	}()
+
+	// give the daemon time to load the config
+	time.Sleep(200 * time.Millisecond)
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+func trashed(path string) func() bool {
+	return func() bool {
+		_, err := os.Lstat(path)
+		return os.IsNotExist(err)
+	}
+}
+
+func TestDaemonSchedule(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	configPath := writeDaemonConfig(t, dir, map[string]string{"scheduled": "@every 1s", "manual": ""})
+	stop := startDaemon(t, dir, configPath, nil)
+
+	assert.Eventually(trashed(filepath.Join(dir, "scheduled", "source", "paper.pdf")), 5*time.Second, 100*time.Millisecond)
+	assert.NoError(stop())
+
+	// strategies without schedule are never run by the daemon
+	assert.FileExists(filepath.Join(dir, "manual", "source", "paper.pdf"))
+}
+
+func TestDaemonReload(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	configPath := writeDaemonConfig(t, dir, map[string]string{"name1": ""})
+	reload := make(chan os.Signal, 1)
+	stop := startDaemon(t, dir, configPath, reload)
+
+	// an invalid config is reported and the old one is kept
+	assert.NoError(os.WriteFile(configPath, []byte("{"), 0644))
+	reload <- syscall.SIGHUP
+	time.Sleep(200 * time.Millisecond)
+	assert.FileExists(filepath.Join(dir, "name1", "source", "paper.pdf"))
+
+	// the reloaded config schedules the strategy
+	writeDaemonConfig(t, dir, map[string]string{"name1": "@every 1s"})
+	reload <- syscall.SIGHUP
+	assert.Eventually(trashed(filepath.Join(dir, "name1", "source", "paper.pdf")), 5*time.Second, 100*time.Millisecond)
+	assert.NoError(stop())
+}
+
+func TestDaemonLocked(t *testing.T) {
+	dir := t.TempDir()
+	configPath := writeDaemonConfig(t, dir, map[string]string{"name1": "@every 1s"})
+	unlock, err := file_cleaner.Lock(configPath, file_cleaner.LockOptions{Dir: dir})
+	assert.NoError(t, err)
+	defer unlock()
+
+	err = file_cleaner.RunDaemon(context.Background(), configPath, file_cleaner.CmdLineArgs{}, file_cleaner.LockOptions{Dir: dir}, nil)
+	assert.ErrorIs(t, err, file_cleaner.ErrLocked)
+}
+
+func TestDaemonInvalidSchedule(t *testing.T) {
+	dir := t.TempDir()
+	configPath := writeDaemonConfig(t, dir, map[string]string{"name1": "every hour"})
+	var config file_cleaner.Config
+	assert.Error(t, config.Load(configPath))
+}
+
+// a run that moves files to a locked trash is skipped until the lock is released
+func TestDaemonTrashLocked(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	configPath := writeDaemonConfig(t, dir, map[string]string{"name1": "@every 1s"})
+	unlock, err := file_cleaner.LockTrash([]string{filepath.Join(dir, "trash")}, file_cleaner.LockOptions{Dir: dir})
+	assert.NoError(err)
+	stop := startDaemon(t, dir, configPath, nil)
+
+	time.Sleep(1500 * time.Millisecond)
+	assert.FileExists(filepath.Join(dir, "name1", "source", "paper.pdf"))
+
+	unlock()
+	assert.Eventually(trashed(filepath.Join(dir, "name1", "source", "paper.pdf")), 5*time.Second, 100*time.Millisecond)
+	assert.NoError(stop())
+}
@@ -0,0 +1,66 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// runDecider runs the dedupe on a MemFS with two identical targets and answers from input
+func runDecider(t *testing.T, input string, output io.Writer) (*file_cleaner.StrategyReport, *file_cleaner.MemFS) {
+	fsys := newTestMemFS(t, map[string]string{
+		"target/a.txt":  "one",
+		"target/b.txt":  "one",
+		"source/1.txt":  "one",
+		"source/2.txt":  "one",
+		"source/3.txt":  "one",
+		"source/no.txt": "unique",
+	})
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(t, err)
+
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	config.SetDecider(file_cleaner.NewPromptDecider(strings.NewReader(input), output))
+	assert.Nil(t, config.AddStrategy("test", strategy))
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{})
+	assert.Nil(t, err)
+	return report.Strategies[0], fsys
+}
+
+func TestPromptDecider(t *testing.T) {
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	// an invalid answer asks again, 2 keeps the second target, s skips, the end of the input skips the rest
+	var output strings.Builder
+	report, fsys := runDecider(t, "x\n2\ns\n", &output)
+	assert.Contains(t, output.String(), "Duplicate group 1")
+	assert.Contains(t, output.String(), "[2] /target/b.txt (3 bytes")
+	assert.Contains(t, output.String(), "Invalid answer: x")
+	assert.Equal(t, 1, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(t, 2, report.Count(file_cleaner.ReportSkipped))
+	for _, entry := range report.Entries {
+		switch entry.Kind {
+		case file_cleaner.ReportDuplicate:
+			assert.Equal(t, "/target/b.txt", entry.Keep)
+		case file_cleaner.ReportSkipped:
+			_, err := fsys.Stat(file_cleaner.FSName(entry.Path))
+			assert.Nil(t, err)
+		}
+	}
+
+	report, _ = runDecider(t, "a\n", io.Discard)
+	assert.Equal(t, 3, report.Count(file_cleaner.ReportDuplicate))
+
+	report, _ = runDecider(t, "\nn\n", io.Discard)
+	assert.Equal(t, 1, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(t, 2, report.Count(file_cleaner.ReportSkipped))
+}
@@ -1,9 +1,11 @@
 package file_cleaner
 
 import (
+	"bytes"
+	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"runtime"
 	"testing"
 
 	file_cleaner "github.com/r888800009/file_cleaner/core"
@@ -15,12 +17,17 @@ func TestEntryEqual(t *testing.T) {
 	var entry file_cleaner.FileEntry
 	var entry2 file_cleaner.FileEntry
 
-	entry.Load("/etc/hosts")
-	entry2.Load("/etc/hosts")
+	fsys := file_cleaner.NewMemFS()
+	assert.Nil(fsys.MkdirAll("etc", 0755))
+	assert.Nil(fsys.WriteFile("etc/hosts", []byte("127.0.0.1 localhost\n"), 0644))
+	assert.Nil(fsys.WriteFile("etc/passwd", []byte("root:x:0:0::/root:/bin/sh\n"), 0644))
+
+	assert.Nil(entry.LoadFS(fsys, "/etc/hosts"))
+	assert.Nil(entry2.LoadFS(fsys, "/etc/hosts"))
 	assert.True(entry.Equal(&entry2))
 
-	entry.Load("/etc/hosts")
-	entry2.Load("/etc/passwd")
+	assert.Nil(entry.LoadFS(fsys, "/etc/hosts"))
+	assert.Nil(entry2.LoadFS(fsys, "/etc/passwd"))
 	assert.False(entry.Equal(&entry2))
 }
 
@@ -37,16 +44,11 @@ func TestIsPathNotIndepent(t *testing.T) {
 	assert.False(file_cleaner.IsPathNotIndepent("./file", "/home/user"))
 	assert.False(file_cleaner.IsPathNotIndepent("/etc/host", "/etc/hostname"))
 
-	// cd should not affect the result
-	// note: the test may depend on operating system, for example, in macos would using symlink for /tmp and /home
-	// check /bin is not symlink
-	if link, _ := os.Readlink("/bin"); link != "" {
-		assert.FailNow("The /bin is symlink, the test may not work")
-	}
-
-	os.Chdir("/bin")
-	assert.True(file_cleaner.IsPathNotIndepent(".", "/bin"))
-	assert.True(file_cleaner.IsPathNotIndepent("./", "/bin/vim"))
+	// relative paths are resolved from the working directory
+	cwd, err := os.Getwd()
+	assert.Nil(err)
+	assert.True(file_cleaner.IsPathNotIndepent(".", cwd))
+	assert.True(file_cleaner.IsPathNotIndepent("./", filepath.Join(cwd, "vim")))
 }
 
 func TestPathNomalizePair(t *testing.T) {
@@ -97,13 +99,7 @@ func TestIsPathNotIndepentRecursiveFalse(t *testing.T) {
 func TestListFiles(t *testing.T) {
 	assert := assert.New(t)
 
-	_, filename, _, _ := runtime.Caller(0)
-	t.Logf("Current test filename: %s", filename)
-	t.Logf("Current test directory: %s", filepath.Dir(filename))
-
-	// change to the test directory
-	os.Chdir(filepath.Dir(filename))
-
+	// go test runs in the package directory, the paths are relative to it
 	// test recursive
 	dirEntry := file_cleaner.CreateDirEntry("data/listfile/", true)
 	_, fileMap := file_cleaner.ListFiles(dirEntry)
@@ -116,3 +112,60 @@ func TestListFiles(t *testing.T) {
 	_, fileMap = file_cleaner.ListFiles(dirEntry)
 	assert.NotContains(fileMap, "data/listfile/")
 }
+
+// shortReadFS returns files that read at most 7 bytes per call
+type shortReadFS struct {
+	*file_cleaner.MemFS
+}
+
+type shortReadFile struct {
+	fs.File
+}
+
+func (fsys shortReadFS) Open(name string) (fs.File, error) {
+	file, err := fsys.MemFS.Open(name)
+	return shortReadFile{file}, err
+}
+
+func (file shortReadFile) Read(buffer []byte) (int, error) {
+	if len(buffer) > 7 {
+		buffer = buffer[:7]
+	}
+	return file.File.Read(buffer)
+}
+
+// test short reads of one file are not a difference
+func TestCompareWith(t *testing.T) {
+	assert := assert.New(t)
+	fsys := file_cleaner.NewMemFS()
+	content := bytes.Repeat([]byte("0123456789"), 30000)
+	changed := append(append([]byte{}, content[:len(content)-1]...), 'x')
+	assert.Nil(fsys.WriteFile("a", content, 0644))
+	assert.Nil(fsys.WriteFile("b", content, 0644))
+	assert.Nil(fsys.WriteFile("c", changed, 0644))
+
+	var entry, same, other file_cleaner.FileEntry
+	assert.Nil(entry.LoadFS(shortReadFS{fsys}, "/a"))
+	assert.Nil(same.LoadFS(fsys, "/b"))
+	assert.Nil(other.LoadFS(fsys, "/c"))
+	assert.True(entry.Compare(&same))
+	assert.False(entry.Compare(&other))
+
+	for _, options := range []file_cleaner.CompareOptions{{}, {TrustHash: true}} {
+		equal, err := entry.CompareWith(context.Background(), &same, options)
+		assert.Nil(err)
+		assert.True(equal)
+		equal, err = entry.CompareWith(context.Background(), &other, options)
+		assert.Nil(err)
+		assert.False(equal)
+	}
+
+	// a cancelled comparison is not equal
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var fresh file_cleaner.FileEntry
+	assert.Nil(fresh.LoadFS(fsys, "/a"))
+	equal, err := fresh.CompareWith(ctx, &same, file_cleaner.CompareOptions{TrustHash: true})
+	assert.False(equal)
+	assert.ErrorIs(err, context.Canceled)
+}
@@ -0,0 +1,133 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMemFS creates a MemFS with the given files, parent directories are created
+func newTestMemFS(t *testing.T, files map[string]string) *file_cleaner.MemFS {
+	fsys := file_cleaner.NewMemFS()
+	for name, content := range files {
+		assert.Nil(t, fsys.MkdirAll(path.Dir(name), 0755))
+		assert.Nil(t, fsys.WriteFile(name, []byte(content), 0644))
+	}
+	return fsys
+}
+
+func TestMemFS(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	fsys := newTestMemFS(t, map[string]string{
+		"data/a.txt":     "a",
+		"data/dir/b.txt": "bb",
+	})
+	assert.Nil(fsys.Symlink("/data/dir", "data/link"))
+	assert.Nil(fstest.TestFS(fsys, "data/a.txt", "data/dir/b.txt"))
+
+	// symlinked parents are followed, the link itself is not
+	info, err := fsys.Stat("data/link/b.txt")
+	assert.Nil(err)
+	assert.Equal(int64(2), info.Size())
+	info, err = fsys.Lstat("data/link")
+	assert.Nil(err)
+	assert.NotZero(info.Mode() & fs.ModeSymlink)
+
+	// a renamed directory keeps its content
+	assert.Nil(fsys.Rename("data/dir", "moved"))
+	content, err := fs.ReadFile(fsys, "moved/b.txt")
+	assert.Nil(err)
+	assert.Equal("bb", string(content))
+	_, err = fsys.Stat("data/link/b.txt")
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	assert.NotNil(fsys.Remove("moved"))
+	assert.Nil(fsys.Remove("moved/b.txt"))
+	assert.Nil(fsys.Remove("moved"))
+}
+
+func TestListFilesFS(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	fsys := newTestMemFS(t, map[string]string{
+		"root/a.txt":       "a",
+		"root/dir/b.txt":   "b",
+		"outside/c.txt":    "c",
+		"outside/sub/d.md": "d",
+	})
+	assert.Nil(fsys.Symlink("../outside", "root/outside"))
+	assert.Nil(fsys.Symlink("/root", "outside/sub/loop"))
+
+	dirEntry := file_cleaner.CreateDirEntry("/root", true)
+	_, fileMap := mustListFiles(t, fsys, dirEntry)
+	assert.Contains(fileMap, "/root/a.txt")
+	assert.Contains(fileMap, "/root/dir/b.txt")
+	assert.NotContains(fileMap, "/root/outside/c.txt")
+
+	// followed links keep the link path, the loop back to the root is skipped
+	assert.Nil(dirEntry.SetSymlinkPolicy(file_cleaner.SymlinkFollow))
+	sizeIndex, fileMap := mustListFiles(t, fsys, dirEntry)
+	assert.Contains(fileMap, "/root/outside/c.txt")
+	assert.Contains(fileMap, "/root/outside/sub/d.md")
+	assert.NotContains(fileMap, "/root/outside/sub/loop/a.txt")
+	assert.Len(sizeIndex[1], 4)
+}
+
+func mustListFiles(t *testing.T, fsys file_cleaner.ReadFS, dirEntry file_cleaner.DirEntry) (map[int64]([]file_cleaner.FileEntry), map[string]file_cleaner.FileEntry) {
+	sizeIndex, fileMap, err := file_cleaner.ListFilesFS(context.Background(), fsys, dirEntry)
+	assert.Nil(t, err)
+	return sizeIndex, fileMap
+}
+
+// test a strategy on a MemFS, the host is never touched
+func TestExecuteMemFS(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	fsys := newTestMemFS(t, map[string]string{
+		"target/a.txt":      "same",
+		"source/copy.txt":   "same",
+		"source/unique.txt": "unique",
+	})
+	assert.Nil(fsys.MkdirAll("trash", 0755))
+
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(err)
+
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	assert.Nil(config.AddStrategy("test", strategy))
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{ReplaceAsSymlink: true})
+	assert.Nil(err)
+	assert.Equal(1, report.Strategies[0].Count(file_cleaner.ReportDuplicate))
+
+	entry := report.Strategies[0].Entries[0]
+	content, err := fs.ReadFile(fsys, file_cleaner.FSName(entry.TrashPath))
+	assert.Nil(err)
+	assert.Equal("same", string(content))
+
+	link, err := fsys.ReadLink("source/copy.txt")
+	assert.Nil(err)
+	assert.Equal("/target/a.txt", link)
+
+	records, err := file_cleaner.ReadManifestFS(fsys, report.Strategies[0].TrashDir+"/"+file_cleaner.ManifestName)
+	assert.Nil(err)
+	assert.Len(records, 2)
+
+	// nothing was moved on the host file system
+	_, err = os.Stat(entry.TrashPath)
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
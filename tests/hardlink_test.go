@@ -0,0 +1,103 @@
+package file_cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeDedupeConfig writes a single source_to_target_dedupe config for dir/target and dir/source
+func writeDedupeConfig(t *testing.T, dir string) string {
+	config := map[string]interface{}{
+		"version": "0.1",
+		"dedupe": map[string]interface{}{
+			"strategy":   "source_to_target_dedupe",
+			"target_dir": map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+			"trash_dir":  filepath.Join(dir, "trash"),
+			"source_dirs": []interface{}{
+				map[string]interface{}{"path": filepath.Join(dir, "source"), "recursive": true},
+			},
+		},
+	}
+	data, err := json.Marshal(config)
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "config.json")
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// runDedupe loads the config in dir and executes it
+func runDedupe(t *testing.T, dir string, dryRun bool) *file_cleaner.StrategyReport {
+	var config file_cleaner.Config
+	assert.NoError(t, config.Load(writeDedupeConfig(t, dir)))
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: dryRun})
+	assert.NoError(t, err)
+	assert.Len(t, report.Strategies, 1)
+	return report.Strategies[0]
+}
+
+func skipWithoutHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inode numbers are not available")
+	}
+}
+
+func TestHardlinkToLaterTarget(t *testing.T) {
+	skipWithoutHardlinks(t)
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "target"), 0755))
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "source"), 0755))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "target", "a.txt"), []byte("same"), 0644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "target", "b.txt"), []byte("same"), 0644))
+	assert.NoError(os.Link(filepath.Join(dir, "target", "b.txt"), filepath.Join(dir, "source", "s.txt")))
+
+	report := runDedupe(t, dir, false)
+	assert.Equal(1, report.Count(file_cleaner.ReportHardlink))
+	assert.Equal(0, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(filepath.Join(dir, "target", "b.txt"), report.Entries[0].Keep)
+	assert.FileExists(filepath.Join(dir, "source", "s.txt"))
+}
+
+func TestHardlinkNamesCollapsed(t *testing.T) {
+	skipWithoutHardlinks(t)
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "target"), 0755))
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "source"), 0755))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "target", "a.txt"), []byte("same"), 0644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "source", "s.txt"), []byte("same"), 0644))
+	assert.NoError(os.Link(filepath.Join(dir, "source", "s.txt"), filepath.Join(dir, "source", "t.txt")))
+
+	// both names share one inode, it is listed once with the other name attached
+	sizeIndex, _ := file_cleaner.ListFiles(file_cleaner.CreateDirEntry(filepath.Join(dir, "source"), true))
+	assert.Len(sizeIndex[4], 1)
+	assert.Len(sizeIndex[4][0].Hardlinks(), 1)
+
+	// all names must be trashed, otherwise no space is freed
+	report := runDedupe(t, dir, false)
+	assert.Equal(2, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(0, report.Count(file_cleaner.ReportHardlink))
+	assert.NoFileExists(filepath.Join(dir, "source", "s.txt"))
+	assert.NoFileExists(filepath.Join(dir, "source", "t.txt"))
+}
+
+func TestHardlinkDryRunReported(t *testing.T) {
+	skipWithoutHardlinks(t)
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "target"), 0755))
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "source"), 0755))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "target", "a.txt"), []byte("same"), 0644))
+	assert.NoError(os.Link(filepath.Join(dir, "target", "a.txt"), filepath.Join(dir, "source", "s.txt")))
+
+	report := runDedupe(t, dir, true)
+	assert.Equal(1, report.Count(file_cleaner.ReportHardlink))
+	assert.Equal(filepath.Join(dir, "source", "s.txt"), report.Entries[0].Path)
+}
@@ -0,0 +1,240 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+fixture is a declarative file tree, the keys are slash separated paths below the fixture root.
+symlinks map the link to its destination, a destination is relative to the root as well.
+*/
+type fixture struct {
+	files    map[string]string
+	symlinks map[string]string
+}
+
+// build creates the tree in a new temporary directory and returns its root
+func (tree fixture) build(t *testing.T) string {
+	root := t.TempDir()
+	for name, content := range tree.files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	for name, destination := range tree.symlinks {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, os.Symlink(filepath.Join(root, filepath.FromSlash(destination)), path))
+	}
+	return root
+}
+
+// readFixture reads the tree below root back into a fixture, the trash directory is skipped
+func readFixture(t *testing.T, root string) fixture {
+	tree := fixture{files: map[string]string{}, symlinks: map[string]string{}}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+		switch {
+		case entry.IsDir() && name == "trash":
+			return filepath.SkipDir
+		case entry.Type()&fs.ModeSymlink != 0:
+			destination, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			tree.symlinks[name] = filepath.ToSlash(strings.TrimPrefix(destination, root+string(filepath.Separator)))
+		case entry.Type().IsRegular() && name != "config.json":
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			tree.files[name] = string(content)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	return tree
+}
+
+// harnessCase runs a config against a fixture, {root} in the config is the fixture root
+type harnessCase struct {
+	name   string
+	tree   fixture
+	config string
+	cmd    file_cleaner.CmdLineArgs
+
+	// want is the tree after the run, trash lists the trashed files by their original name
+	want   fixture
+	trash  []string
+	report map[string]int
+}
+
+func (test harnessCase) run(t *testing.T) {
+	assert := assert.New(t)
+	root := test.tree.build(t)
+
+	configPath := filepath.Join(root, "config.json")
+	config := strings.ReplaceAll(test.config, "{root}", root)
+	assert.Nil(os.WriteFile(configPath, []byte(config), 0644))
+
+	loaded := new(file_cleaner.Config)
+	assert.Nil(loaded.Load(configPath))
+	report, err := loaded.Execute(context.Background(), test.cmd)
+	assert.Nil(err)
+
+	// the resulting tree
+	if test.want.symlinks == nil {
+		test.want.symlinks = map[string]string{}
+	}
+	assert.Equal(test.want, readFixture(t, root))
+
+	// the trash session keeps the absolute path of each file
+	assert.Len(report.Strategies, 1)
+	trashDir := report.Strategies[0].TrashDir
+	for _, name := range test.trash {
+		assert.FileExists(filepath.Join(trashDir, root, filepath.FromSlash(name)))
+	}
+	records, _ := file_cleaner.ReadManifest(filepath.Join(trashDir, file_cleaner.ManifestName))
+	trashed := 0
+	for _, record := range records {
+		if record.Action == file_cleaner.ManifestTrash {
+			trashed++
+		}
+	}
+	assert.Equal(len(test.trash), trashed)
+	if len(test.trash) == 0 {
+		assert.NoDirExists(trashDir)
+	}
+
+	for kind, count := range test.report {
+		assert.Equal(count, report.Strategies[0].Count(kind), kind)
+	}
+}
+
+const harnessConfig = `{
+	"version": "0.1",
+	"test": {
+		"strategy": "source_to_target_dedupe",
+		"target_dir": {"path": "{root}/target", "recursive": true},
+		"source_dirs": [{"path": "{root}/source", "recursive": true}],
+		"trash_dir": "{root}/trash"
+	}
+}`
+
+func TestHarness(t *testing.T) {
+	file_cleaner.SetOutput(io.Discard)
+	t.Cleanup(func() { file_cleaner.SetOutput(os.Stdout) })
+
+	tree := fixture{files: map[string]string{
+		"target/docs/a.txt":         "same",
+		"target/docs/deep/b.txt":    "nested",
+		"source/copy.txt":           "same",
+		"source/sub/dir/b copy.txt": "nested",
+		"source/unique.txt":         "unique",
+	}}
+
+	tests := []harnessCase{
+		{
+			name:   "dry run",
+			tree:   tree,
+			config: harnessConfig,
+			cmd:    file_cleaner.CmdLineArgs{DryRun: true},
+			want:   tree,
+			report: map[string]int{file_cleaner.ReportDuplicate: 2},
+		},
+		{
+			name:   "nested dirs",
+			tree:   tree,
+			config: harnessConfig,
+			want: fixture{files: map[string]string{
+				"target/docs/a.txt":      "same",
+				"target/docs/deep/b.txt": "nested",
+				"source/unique.txt":      "unique",
+			}},
+			trash:  []string{"source/copy.txt", "source/sub/dir/b copy.txt"},
+			report: map[string]int{file_cleaner.ReportDuplicate: 2},
+		},
+		{
+			name:   "symlink replacement",
+			tree:   tree,
+			config: harnessConfig,
+			cmd:    file_cleaner.CmdLineArgs{ReplaceAsSymlink: true},
+			want: fixture{
+				files: map[string]string{
+					"target/docs/a.txt":      "same",
+					"target/docs/deep/b.txt": "nested",
+					"source/unique.txt":      "unique",
+				},
+				symlinks: map[string]string{
+					"source/copy.txt":           "target/docs/a.txt",
+					"source/sub/dir/b copy.txt": "target/docs/deep/b.txt",
+				},
+			},
+			trash:  []string{"source/copy.txt", "source/sub/dir/b copy.txt"},
+			report: map[string]int{file_cleaner.ReportDuplicate: 2},
+		},
+		{
+			name: "ignore and match",
+			tree: fixture{files: map[string]string{
+				"target/a.txt":         "same",
+				"source/copy.txt":      "same",
+				"source/copy.txt.part": "same",
+				"source/copy.md":       "same",
+			}},
+			config: strings.Replace(harnessConfig, `"recursive": true}]`, `"recursive": true, "match": "\\.(txt|part)$", "ignore": "\\.part$"}]`, 1),
+			want: fixture{files: map[string]string{
+				"target/a.txt":         "same",
+				"source/copy.txt.part": "same",
+				"source/copy.md":       "same",
+			}},
+			trash:  []string{"source/copy.txt"},
+			report: map[string]int{file_cleaner.ReportDuplicate: 1},
+		},
+		{
+			name:   "not recursive source",
+			tree:   tree,
+			config: strings.Replace(harnessConfig, `/source", "recursive": true`, `/source", "recursive": false`, 1),
+			want: fixture{files: map[string]string{
+				"target/docs/a.txt":         "same",
+				"target/docs/deep/b.txt":    "nested",
+				"source/sub/dir/b copy.txt": "nested",
+				"source/unique.txt":         "unique",
+			}},
+			trash:  []string{"source/copy.txt"},
+			report: map[string]int{file_cleaner.ReportDuplicate: 1},
+		},
+		{
+			name: "symlinks in source are skipped",
+			tree: fixture{
+				files:    map[string]string{"target/a.txt": "same", "outside/copy.txt": "same"},
+				symlinks: map[string]string{"source/link.txt": "outside/copy.txt"},
+			},
+			config: harnessConfig,
+			want: fixture{
+				files:    map[string]string{"target/a.txt": "same", "outside/copy.txt": "same"},
+				symlinks: map[string]string{"source/link.txt": "outside/copy.txt"},
+			},
+			report: map[string]int{file_cleaner.ReportDuplicate: 0},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			test.run(t)
+		})
+	}
+}
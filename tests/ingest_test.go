@@ -0,0 +1,204 @@
+package file_cleaner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeIngestFile(t *testing.T, path string, content string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// runIngest executes an ingest strategy over dir/target and the given source dirs
+func runIngest(t *testing.T, dir string, ingest map[string]interface{}, dryRun bool, sources ...string) *file_cleaner.StrategyReport {
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "target"), 0755))
+	var sourceDirs []interface{}
+	for _, source := range sources {
+		sourceDirs = append(sourceDirs, map[string]interface{}{"path": filepath.Join(dir, source), "recursive": true})
+	}
+
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":    "source_to_target_dedupe",
+		"target_dir":  map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": sourceDirs,
+		"ingest":      ingest,
+	})
+	assert.NoError(t, err)
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: dryRun})
+	assert.NoError(t, err)
+	return report.Strategies[0]
+}
+
+// destinations maps the base name of each ingested file to its destination
+func destinations(report *file_cleaner.StrategyReport, kind string) map[string]string {
+	result := make(map[string]string)
+	for _, entry := range report.Entries {
+		if entry.Kind == kind {
+			result[filepath.Base(entry.Path)] = entry.Destination
+		}
+	}
+	return result
+}
+
+func TestIngestLayoutExtension(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "source", "paper.PDF"), "paper")
+	writeIngestFile(t, filepath.Join(dir, "source", "notes", "README"), "readme")
+
+	report := runIngest(t, dir, map[string]interface{}{}, false, "source")
+	result := destinations(report, file_cleaner.ReportIngest)
+	target := filepath.Join(dir, "target")
+	assert.Equal(filepath.Join(target, "pdf", "paper.PDF"), result["paper.PDF"])
+	assert.Equal(filepath.Join(target, "no_extension", "README"), result["README"])
+	assert.FileExists(filepath.Join(target, "pdf", "paper.PDF"))
+	assert.NoFileExists(filepath.Join(dir, "source", "paper.PDF"))
+}
+
+func TestIngestLayoutDate(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "source", "paper.pdf")
+	writeIngestFile(t, path, "paper")
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	assert.NoError(os.Chtimes(path, modTime, modTime))
+
+	inbox := filepath.Join(dir, "target", "inbox")
+	report := runIngest(t, dir, map[string]interface{}{"dir": inbox, "layout": "date"}, true, "source")
+	assert.Equal(filepath.Join(inbox, "2024", "05", "paper.pdf"), destinations(report, file_cleaner.ReportIngest)["paper.pdf"])
+	assert.FileExists(path)
+}
+
+func TestIngestLayoutMirror(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "source", "a", "b", "paper.pdf"), "paper")
+
+	report := runIngest(t, dir, map[string]interface{}{"layout": "mirror"}, false, "source")
+	destination := filepath.Join(dir, "target", "a", "b", "paper.pdf")
+	assert.Equal(destination, destinations(report, file_cleaner.ReportIngest)["paper.pdf"])
+	assert.FileExists(destination)
+}
+
+func TestIngestUnknownLayout(t *testing.T) {
+	dir := t.TempDir()
+	_, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":    "source_to_target_dedupe",
+		"target_dir":  map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{},
+		"ingest":      map[string]interface{}{"layout": "by_size"},
+	})
+	assert.Error(t, err)
+}
+
+func TestIngestPlannedCollision(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "first", "paper.pdf"), "first")
+	writeIngestFile(t, filepath.Join(dir, "second", "paper.pdf"), "second")
+
+	// nothing is moved in a dry run, the second file still collides with the planned first one
+	report := runIngest(t, dir, map[string]interface{}{}, true, "first", "second")
+	assert.Equal(1, report.Count(file_cleaner.ReportIngest))
+	assert.Equal(1, report.Count(file_cleaner.ReportCollision))
+	assert.Equal(filepath.Join(dir, "first", "paper.pdf"), report.Entries[0].Path)
+	assert.Equal(filepath.Join(dir, "second", "paper.pdf"), report.Entries[1].Path)
+	assert.NoFileExists(filepath.Join(dir, "target", "pdf", "paper.pdf"))
+}
+
+func TestIngestExistingCollision(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "pdf", "paper.pdf"), "kept")
+	writeIngestFile(t, filepath.Join(dir, "source", "paper.pdf"), "other")
+
+	report := runIngest(t, dir, map[string]interface{}{}, false, "source")
+	assert.Equal(1, report.Count(file_cleaner.ReportCollision))
+	content, err := os.ReadFile(filepath.Join(dir, "target", "pdf", "paper.pdf"))
+	assert.NoError(err)
+	assert.Equal("kept", string(content))
+	assert.FileExists(filepath.Join(dir, "source", "paper.pdf"))
+}
+
+func TestIngestUpdatesIndex(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "first", "paper.pdf"), "paper")
+	writeIngestFile(t, filepath.Join(dir, "second", "copy.pdf"), "paper")
+
+	// the moved file joins the index, the copy in the next source is a duplicate of it
+	report := runIngest(t, dir, map[string]interface{}{}, false, "first", "second")
+	destination := filepath.Join(dir, "target", "pdf", "paper.pdf")
+	assert.Equal(1, report.Count(file_cleaner.ReportIngest))
+	assert.Equal(1, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(destination, report.Entries[1].Keep)
+	assert.Equal(filepath.Join(dir, "target"), report.Entries[1].KeepRoot)
+	assert.FileExists(destination)
+	assert.NoFileExists(filepath.Join(dir, "second", "copy.pdf"))
+}
+
+func TestIngestOverlapsSource(t *testing.T) {
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "source", "paper.pdf"), "paper")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "target"), 0755))
+
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":    "source_to_target_dedupe",
+		"target_dir":  map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{map[string]interface{}{"path": filepath.Join(dir, "source"), "recursive": true}},
+		"ingest":      map[string]interface{}{"dir": filepath.Join(dir, "source", "inbox")},
+	})
+	assert.NoError(t, err)
+	_, err = config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true})
+	assert.Error(t, err)
+}
+
+// test the identical file at the destination is not trashed if it changed after the comparison
+func TestIngestReplaceChanged(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "inbox", "txt", "paper.txt")
+	writeIngestFile(t, existing, "same")
+	writeIngestFile(t, filepath.Join(dir, "source", "paper.txt"), "same")
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "target"), 0755))
+
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":    "source_to_target_dedupe",
+		"target_dir":  map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{map[string]interface{}{"path": filepath.Join(dir, "source"), "recursive": true}},
+		"ingest":      map[string]interface{}{"dir": filepath.Join(dir, "inbox"), "collision": "replace_if_identical"},
+	})
+	assert.NoError(err)
+
+	// the destination is read for the hash and the byte comparison, it is edited after the comparison
+	opens := 0
+	config.SetFS(hookFS{FileSystem: file_cleaner.OSFS{}, onOpen: func(name string) {
+		if name == file_cleaner.FSName(existing) {
+			opens++
+			if opens == 2 {
+				assert.NoError(os.Chtimes(existing, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+			}
+		}
+	}})
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: false})
+	assert.NoError(err)
+	strategy := report.Strategies[0]
+	assert.Equal(0, strategy.Count(file_cleaner.ReportIngest))
+	assert.Equal(1, strategy.Count(file_cleaner.ReportChanged))
+	assert.FileExists(existing)
+	assert.FileExists(filepath.Join(dir, "source", "paper.txt"))
+	assert.Empty(manifests(t, filepath.Join(dir, "trash")))
+}
@@ -0,0 +1,136 @@
+package file_cleaner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockPerConfig(t *testing.T) {
+	assert := assert.New(t)
+	options := file_cleaner.LockOptions{Dir: t.TempDir()}
+
+	unlock, err := file_cleaner.Lock("first.json", options)
+	assert.NoError(err)
+
+	// the same config is locked, another config is not
+	_, err = file_cleaner.Lock("first.json", options)
+	assert.ErrorIs(err, file_cleaner.ErrLocked)
+	unlockSecond, err := file_cleaner.Lock("second.json", options)
+	assert.NoError(err)
+	unlockSecond()
+
+	unlock()
+	unlock, err = file_cleaner.Lock("first.json", options)
+	assert.NoError(err)
+	unlock()
+}
+
+func TestLockWait(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	unlock, err := file_cleaner.Lock("config.json", file_cleaner.LockOptions{Dir: dir})
+	assert.NoError(err)
+
+	// the lock is not released in time
+	start := time.Now()
+	_, err = file_cleaner.Lock("config.json", file_cleaner.LockOptions{Dir: dir, Wait: 300 * time.Millisecond})
+	assert.ErrorIs(err, file_cleaner.ErrLocked)
+	assert.GreaterOrEqual(time.Since(start), 300*time.Millisecond)
+
+	// the lock is released while waiting
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		unlock()
+	}()
+	unlockWaited, err := file_cleaner.Lock("config.json", file_cleaner.LockOptions{Dir: dir, Wait: 5 * time.Second})
+	assert.NoError(err)
+	unlockWaited()
+}
+
+func TestLockStatus(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+
+	states, err := file_cleaner.LockStatus(dir)
+	assert.NoError(err)
+	assert.Empty(states)
+
+	unlock, err := file_cleaner.Lock(configPath, file_cleaner.LockOptions{Dir: dir})
+	assert.NoError(err)
+	states, err = file_cleaner.LockStatus(dir)
+	assert.NoError(err)
+	assert.Len(states, 1)
+	assert.True(states[0].Held)
+	assert.Equal(os.Getpid(), states[0].Info.PID)
+	assert.Equal(configPath, states[0].Info.Config)
+
+	// status never takes the lock, the holder still owns it
+	_, err = file_cleaner.Lock(configPath, file_cleaner.LockOptions{Dir: dir})
+	assert.ErrorIs(err, file_cleaner.ErrLocked)
+
+	unlock()
+	states, err = file_cleaner.LockStatus(dir)
+	assert.NoError(err)
+	assert.Len(states, 1)
+	assert.False(states[0].Held)
+	assert.Nil(states[0].Info)
+}
+
+func TestLockStatusStalePID(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path, err := file_cleaner.LockPathFor(dir, "config.json")
+	assert.NoError(err)
+
+	// a crashed instance leaves its PID behind, the process is gone
+	info, err := json.Marshal(file_cleaner.LockInfo{PID: 1 << 30, StartTime: time.Now(), Config: "config.json"})
+	assert.NoError(err)
+	assert.NoError(os.WriteFile(path, info, 0600))
+
+	states, err := file_cleaner.LockStatus(dir)
+	assert.NoError(err)
+	assert.Len(states, 1)
+	assert.False(states[0].Held)
+}
+
+func TestLockTrash(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	options := file_cleaner.LockOptions{Dir: dir}
+	trash := filepath.Join(dir, "trash")
+
+	// the same root listed twice is locked once
+	unlock, err := file_cleaner.LockTrash([]string{trash, trash + string(filepath.Separator)}, options)
+	assert.NoError(err)
+
+	// a second root is released again if the first one is held
+	_, err = file_cleaner.LockTrash([]string{filepath.Join(dir, "other"), trash}, options)
+	assert.ErrorIs(err, file_cleaner.ErrLocked)
+	unlockOther, err := file_cleaner.LockTrash([]string{filepath.Join(dir, "other")}, options)
+	assert.NoError(err)
+	unlockOther()
+
+	states, err := file_cleaner.LockStatus(dir)
+	assert.NoError(err)
+	held := 0
+	for _, state := range states {
+		if state.Held {
+			held++
+			assert.Equal(trash, state.Info.Trash)
+			assert.Empty(state.Info.Config)
+		}
+	}
+	assert.Equal(1, held)
+
+	unlock()
+	unlock, err = file_cleaner.LockTrash([]string{trash}, options)
+	assert.NoError(err)
+	unlock()
+}
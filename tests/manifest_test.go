@@ -0,0 +1,121 @@
+package file_cleaner
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// manifests returns the manifest files of all trash sessions below trashRoot
+func manifests(t *testing.T, trashRoot string) []string {
+	paths, err := filepath.Glob(filepath.Join(trashRoot, "*", file_cleaner.ManifestName))
+	assert.NoError(t, err)
+	return paths
+}
+
+func TestManifestRecord(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	var empty *file_cleaner.Manifest
+	assert.NoError(empty.Record(file_cleaner.ManifestTrash, "a", "b"))
+
+	manifest := file_cleaner.NewManifest(filepath.Join(dir, "session"))
+	assert.NoFileExists(manifest.Path())
+	assert.NoError(manifest.Record(file_cleaner.ManifestTrash, "/source/a", "/trash/a"))
+	assert.NoError(manifest.Record(file_cleaner.ManifestSymlink, "/target/a", "/source/a"))
+	assert.NoError(manifest.Close())
+
+	records, err := file_cleaner.ReadManifest(manifest.Path())
+	assert.NoError(err)
+	assert.Len(records, 2)
+	assert.Equal(file_cleaner.ManifestTrash, records[0].Action)
+	assert.Equal("/source/a", records[0].From)
+	assert.Equal("/trash/a", records[0].To)
+	assert.Equal(file_cleaner.ManifestSymlink, records[1].Action)
+	assert.False(records[1].Time.IsZero())
+}
+
+func TestManifestOfRun(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "a.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "first", "copy.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "second", "paper.pdf"), "paper")
+
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":   "source_to_target_dedupe",
+		"target_dir": map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+		"trash_dir":  filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{
+			map[string]interface{}{"path": filepath.Join(dir, "first"), "recursive": true},
+			map[string]interface{}{"path": filepath.Join(dir, "second"), "recursive": true},
+		},
+		"ingest": map[string]interface{}{},
+	})
+	assert.NoError(err)
+
+	// a dry run never creates the manifest
+	_, err = config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true, ReplaceAsSymlink: true})
+	assert.NoError(err)
+	assert.Empty(manifests(t, filepath.Join(dir, "trash")))
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: false, ReplaceAsSymlink: true})
+	assert.NoError(err)
+	paths := manifests(t, filepath.Join(dir, "trash"))
+	assert.Len(paths, 1)
+
+	records, err := file_cleaner.ReadManifest(paths[0])
+	assert.NoError(err)
+	assert.Len(records, 3)
+	copyPath := filepath.Join(dir, "first", "copy.txt")
+	assert.Equal(file_cleaner.ManifestTrash, records[0].Action)
+	assert.Equal(copyPath, records[0].From)
+	assert.Equal(report.Strategies[0].Entries[0].TrashPath, records[0].To)
+	assert.Equal(file_cleaner.ManifestSymlink, records[1].Action)
+	assert.Equal(filepath.Join(dir, "target", "a.txt"), records[1].From)
+	assert.Equal(copyPath, records[1].To)
+	assert.Equal(file_cleaner.ManifestMove, records[2].Action)
+	assert.Equal(filepath.Join(dir, "second", "paper.pdf"), records[2].From)
+	assert.Equal(filepath.Join(dir, "target", "pdf", "paper.pdf"), records[2].To)
+}
+
+// a cancelled context stops before any file operation
+func TestExecuteCancelled(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "a.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "source", "copy.txt"), "same")
+
+	var config file_cleaner.Config
+	assert.NoError(config.Load(writeDedupeConfig(t, dir)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := config.Execute(ctx, file_cleaner.CmdLineArgs{DryRun: false})
+	assert.ErrorIs(err, context.Canceled)
+	assert.Len(report.Strategies, 1)
+	assert.Empty(report.Strategies[0].Entries)
+	assert.FileExists(filepath.Join(dir, "source", "copy.txt"))
+	assert.Empty(manifests(t, filepath.Join(dir, "trash")))
+}
+
+// a cancelled watch returns the report at once
+func TestWatchCancelled(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "a.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "source", "copy.txt"), "same")
+
+	var config file_cleaner.Config
+	assert.NoError(config.Load(writeDedupeConfig(t, dir)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := config.Watch(ctx, file_cleaner.CmdLineArgs{DryRun: false}, watchDebounce)
+	assert.ErrorIs(err, context.Canceled)
+	assert.FileExists(filepath.Join(dir, "source", "copy.txt"))
+}
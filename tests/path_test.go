@@ -0,0 +1,155 @@
+package file_cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// isSubPathOracle is the expected result for two clean local paths without symlinks
+func isSubPathOracle(path1 string, path2 string) bool {
+	rel1, err1 := filepath.Rel(path1, path2)
+	rel2, err2 := filepath.Rel(path2, path1)
+	return (err1 == nil && filepath.IsLocal(rel1)) || (err2 == nil && filepath.IsLocal(rel2))
+}
+
+// addPathSeeds adds the cases of the hand written tests to the fuzz corpus
+func addPathSeeds(f *testing.F) {
+	f.Add("etc/hosts", "etc", false, true)
+	f.Add("etc/host", "etc/hostname", true, true)
+	f.Add("a/../b", "b/c/", true, false)
+	f.Add("a//b/", "a/b", false, false)
+	f.Add(".", "x/y", true, true)
+	f.Add("a/./b/..", "a", true, false)
+	f.Add("user/tmp", "tmp", false, true)
+}
+
+/*
+FuzzIsPathNotIndepent checks the result against filepath.Rel for paths below a temporary root,
+the result must be symmetric and a path is never independent of itself or its children.
+*/
+func FuzzIsPathNotIndepent(f *testing.F) {
+	addPathSeeds(f)
+	root := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, path1 string, path2 string, _ bool, _ bool) {
+		if !filepath.IsLocal(path1) || !filepath.IsLocal(path2) || strings.ContainsRune(path1+path2, 0) {
+			t.Skip()
+		}
+		abs1 := filepath.Join(root, path1)
+		abs2 := root + string(filepath.Separator) + path2
+
+		notIndepent, err := file_cleaner.IsPathNotIndepent(abs1, abs2)
+		assert.Nil(t, err)
+		assert.Equal(t, isSubPathOracle(filepath.Clean(abs1), filepath.Clean(abs2)), notIndepent, "%q %q", abs1, abs2)
+
+		swapped, _ := file_cleaner.IsPathNotIndepent(abs2, abs1)
+		assert.Equal(t, notIndepent, swapped)
+
+		self, _ := file_cleaner.IsPathNotIndepent(abs1, abs1+string(filepath.Separator))
+		assert.True(t, self)
+		child, _ := file_cleaner.IsPathNotIndepent(abs1, filepath.Join(abs1, "child"))
+		assert.True(t, child)
+	})
+}
+
+/*
+FuzzIsPathNotIndepentRecursive checks the rules of non-recursive dir entries,
+two recursive entries are the same as IsPathNotIndepent.
+*/
+func FuzzIsPathNotIndepentRecursive(f *testing.F) {
+	addPathSeeds(f)
+	root := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, path1 string, path2 string, recPath1 bool, recPath2 bool) {
+		if !filepath.IsLocal(path1) || !filepath.IsLocal(path2) || strings.ContainsRune(path1+path2, 0) {
+			t.Skip()
+		}
+		abs1 := filepath.Join(root, path1)
+		abs2 := filepath.Join(root, path2)
+
+		notIndepent, err := file_cleaner.IsPathNotIndepentRecursive(abs1, recPath1, abs2, recPath2)
+		assert.Nil(t, err)
+		swapped, _ := file_cleaner.IsPathNotIndepentRecursive(abs2, recPath2, abs1, recPath1)
+		assert.Equal(t, notIndepent, swapped)
+
+		// a recursive entry is never independent of an entry below it
+		subPath := isSubPathOracle(abs1, abs2)
+		switch {
+		case recPath1 && recPath2:
+			assert.Equal(t, subPath, notIndepent)
+		case abs1 == abs2:
+			assert.True(t, notIndepent)
+		case !recPath1 && !recPath2:
+			assert.False(t, notIndepent)
+		case subPath && recPath1 == (len(abs1) < len(abs2)):
+			assert.True(t, notIndepent)
+		}
+	})
+}
+
+/*
+FuzzPathNomalizeRelative checks relative paths are resolved from the working directory,
+the working directory is a temporary directory without symlinks below it.
+*/
+func FuzzPathNomalizeRelative(f *testing.F) {
+	for _, seed := range []string{".", "..", "a/../b", "./x/", "../../c", "a//b/./"} {
+		f.Add(seed)
+	}
+
+	root, err := filepath.EvalSymlinks(f.TempDir())
+	assert.Nil(f, err)
+	cwd := filepath.Join(root, "a", "b", "c")
+	assert.Nil(f, os.MkdirAll(cwd, 0755))
+	previous, err := os.Getwd()
+	assert.Nil(f, err)
+	assert.Nil(f, os.Chdir(cwd))
+	f.Cleanup(func() { os.Chdir(previous) })
+
+	f.Fuzz(func(t *testing.T, path string) {
+		if path == "" || filepath.IsAbs(path) || strings.ContainsRune(path, 0) {
+			t.Skip()
+		}
+		// the expected path must stay below the temporary root
+		expected := filepath.Join(cwd, path)
+		if rel, err := filepath.Rel(root, expected); err != nil || !filepath.IsLocal(rel) {
+			t.Skip()
+		}
+
+		normalized, absolute, err := file_cleaner.PathNomalizePair(path, expected)
+		assert.Nil(t, err)
+		assert.Equal(t, expected+string(filepath.Separator), normalized, "%q", path)
+		assert.Equal(t, absolute, normalized)
+	})
+}
+
+// test symlinked parents and .. segments are resolved as the OS resolves them
+func TestIsPathNotIndepentSymlink(t *testing.T) {
+	assert := assert.New(t)
+	root := t.TempDir()
+	assert.Nil(os.MkdirAll(filepath.Join(root, "target", "sub"), 0755))
+	assert.Nil(os.MkdirAll(filepath.Join(root, "source"), 0755))
+	assert.Nil(os.Symlink(filepath.Join(root, "target", "sub"), filepath.Join(root, "source", "link")))
+
+	// the source is a symlink into the target
+	notIndepent, err := file_cleaner.IsPathNotIndepent(filepath.Join(root, "source", "link"), filepath.Join(root, "target"))
+	assert.Nil(err)
+	assert.True(notIndepent)
+
+	// .. after a symlink is relative to the link destination, a path that does not exist yet is still resolved
+	notIndepent, _ = file_cleaner.IsPathNotIndepent(filepath.Join(root, "source", "link")+"/../new/dir", filepath.Join(root, "target"))
+	assert.True(notIndepent)
+	notIndepent, _ = file_cleaner.IsPathNotIndepent(filepath.Join(root, "source", "new"), filepath.Join(root, "target"))
+	assert.False(notIndepent)
+
+	notIndepent, _ = file_cleaner.IsPathNotIndepentRecursive(filepath.Join(root, "target"), true, filepath.Join(root, "source", "link"), false)
+	assert.True(notIndepent)
+
+	// the root directory contains every path
+	notIndepent, _ = file_cleaner.IsPathNotIndepent("/", root)
+	assert.True(notIndepent)
+}
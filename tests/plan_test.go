@@ -0,0 +1,155 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/r888800009/file_cleaner/tui"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPlanReport is a dry run report with a small and a large group
+func testPlanReport() *file_cleaner.Report {
+	return &file_cleaner.Report{Strategies: []*file_cleaner.StrategyReport{{
+		Name:     "test",
+		TrashDir: "/trash/session",
+		Entries: []file_cleaner.ReportEntry{
+			{Kind: file_cleaner.ReportDuplicate, Path: "/source/small.txt", Keep: "/target/small.txt", Size: 5},
+			{Kind: file_cleaner.ReportHardlink, Path: "/source/link.txt", Keep: "/target/small.txt", Size: 5},
+			{Kind: file_cleaner.ReportDuplicate, Path: "/source/big.pdf", Keep: "/target/big.pdf", Size: 9},
+			{Kind: file_cleaner.ReportDuplicate, Path: "/source/big copy.pdf", Keep: "/target/big.pdf", Size: 9},
+		},
+	}}}
+}
+
+func TestPlan(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	// the groups are sorted by reclaimable space, hardlinks are not part of the plan
+	plan := file_cleaner.NewPlan(testPlanReport())
+	assert.Len(plan.Groups, 2)
+	assert.Equal("/target/big.pdf", plan.Groups[0].Keep)
+	assert.Equal(int64(18), plan.Groups[0].Reclaimable())
+	assert.Equal(int64(23), plan.Reclaimable())
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	assert.Nil(plan.Save(path))
+	loaded, err := file_cleaner.LoadPlan(path)
+	assert.Nil(err)
+	assert.Equal(plan, loaded)
+
+	// unselected files stay, a file changed since the scan is skipped
+	fsys := newTestMemFS(t, map[string]string{
+		"target/small.txt":    "small",
+		"target/big.pdf":      "big pdf!!",
+		"source/small.txt":    "small",
+		"source/big.pdf":      "big pdf!!",
+		"source/big copy.pdf": "changed!!",
+	})
+	plan.Groups[1].Files[0].Selected = false
+
+	report, err := plan.Apply(context.Background(), fsys, file_cleaner.CmdLineArgs{DryRun: true})
+	assert.Nil(err)
+	assert.Equal(1, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(1, report.Count(file_cleaner.ReportChanged))
+
+	report, err = plan.Apply(context.Background(), fsys, file_cleaner.CmdLineArgs{})
+	assert.Nil(err)
+	assert.Equal(1, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(1, report.Count(file_cleaner.ReportChanged))
+	_, err = fsys.Stat("trash/session/source/big.pdf")
+	assert.Nil(err)
+	_, err = fsys.Stat("source/small.txt")
+	assert.Nil(err)
+}
+
+// press sends the keys to the model, each string is one key
+func press(model tea.Model, keys ...string) tea.Cmd {
+	var cmd tea.Cmd
+	for _, key := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		case " ":
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}
+		}
+		model, cmd = model.Update(msg)
+	}
+	return cmd
+}
+
+func TestTUI(t *testing.T) {
+	assert := assert.New(t)
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	model := tui.New(file_cleaner.NewPlan(testPlanReport()), planPath)
+	assert.Contains(model.View(), "2 groups, 23 B selected of 2 shown")
+
+	// the extension filter hides the txt group, space toggles the whole pdf group
+	press(model, "/", ".", "p", "d", "f", "enter")
+	assert.Contains(model.View(), "of 1 shown")
+	press(model, " ")
+	assert.Equal(int64(0), model.Plan().Groups[0].Reclaimable())
+
+	// the preview toggles a single file and shows the live metadata
+	press(model, "enter", "2")
+	assert.Contains(model.View(), "2 [x] /source/big copy.pdf (missing)")
+	assert.Equal(int64(9), model.Plan().Groups[0].Reclaimable())
+
+	// esc while typing clears the filter
+	press(model, "/", "esc")
+	assert.Contains(model.View(), "of 2 shown")
+
+	press(model, "w")
+	assert.FileExists(planPath)
+
+	press(model, "a", "n")
+	assert.False(model.Apply())
+	cmd := press(model, "a", "y")
+	assert.True(model.Apply())
+	assert.IsType(tea.QuitMsg{}, cmd())
+}
+
+func TestPlanTrashRoots(t *testing.T) {
+	plan := &file_cleaner.Plan{Groups: []file_cleaner.PlanGroup{
+		{TrashDir: "/trash/2024-05-01-12-00-00.000"},
+		{TrashDir: "/trash/2024-05-01-12-00-00.000"},
+		{TrashDir: "/other/2024-05-02-12-00-00.000"},
+	}}
+	assert.Equal(t, []string{"/trash", "/other"}, plan.TrashRoots())
+}
+
+func TestPlanCheck(t *testing.T) {
+	assert := assert.New(t)
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", false)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(err)
+	config := file_cleaner.NewConfig()
+	assert.Nil(config.AddStrategy("test", strategy))
+
+	check := func(trashDir string, keep string, path string) error {
+		plan := &file_cleaner.Plan{Groups: []file_cleaner.PlanGroup{{Keep: keep, TrashDir: trashDir, Files: []file_cleaner.PlanFile{{Path: path}}}}}
+		return plan.Check(config)
+	}
+	session := "/trash/2024-05-01-12-00-00.000"
+	assert.Nil(check(session, "/target/sub/a.txt", "/source/a.txt"))
+	assert.NotNil(check("/trash", "/target/a.txt", "/source/a.txt"))
+	assert.NotNil(check("/trash/a/b", "/target/a.txt", "/source/a.txt"))
+	assert.NotNil(check("/home/2024-05-01-12-00-00.000", "/target/a.txt", "/source/a.txt"))
+	assert.NotNil(check(session, "/home/a.txt", "/source/a.txt"))
+	assert.NotNil(check(session, "/target/a.txt", "/source/../home/a.txt"))
+	// the source is not recursive
+	assert.NotNil(check(session, "/target/a.txt", "/source/sub/a.txt"))
+}
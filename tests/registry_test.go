@@ -0,0 +1,69 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// countStrategy is an in-house strategy registered by the test
+type countStrategy struct {
+	message  string
+	executed int
+}
+
+func (strategy *countStrategy) Load(name string, value map[string]interface{}) error {
+	strategy.message = value["message"].(string)
+	return nil
+}
+
+func (strategy *countStrategy) Execute(ctx context.Context, parms file_cleaner.ExecuteArgs) error {
+	strategy.executed++
+	return nil
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	created := new(countStrategy)
+	err := file_cleaner.RegisterStrategy(file_cleaner.StrategyInfo{
+		Name:        "test_count",
+		Description: "count executions",
+		Schema:      []file_cleaner.ConfigField{{Key: "message", Type: "string", Required: true}},
+		Factory:     func() (file_cleaner.Strategy, error) { return created, nil },
+	})
+	assert.Nil(err)
+
+	// names are unique and a factory is required
+	assert.NotNil(file_cleaner.RegisterStrategy(file_cleaner.StrategyInfo{Name: "test_count", Factory: func() (file_cleaner.Strategy, error) { return nil, nil }}))
+	assert.NotNil(file_cleaner.RegisterStrategy(file_cleaner.StrategyInfo{Name: "test_no_factory"}))
+
+	var names []string
+	for _, info := range file_cleaner.RegisteredStrategies() {
+		names = append(names, info.Name)
+	}
+	assert.Contains(names, "source_to_target_dedupe")
+	assert.Contains(names, "test_count")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.Nil(os.WriteFile(path, []byte(`{"version": "0.1", "entry": {"strategy": "test_count", "message": "hello"}}`), 0644))
+
+	config := new(file_cleaner.Config)
+	assert.Nil(config.Load(path))
+	assert.Equal("hello", created.message)
+
+	_, err = config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true})
+	assert.Nil(err)
+	assert.Equal(1, created.executed)
+
+	// unknown strategies are rejected
+	assert.Nil(os.WriteFile(path, []byte(`{"version": "0.1", "entry": {"strategy": "unknown"}}`), 0644))
+	assert.NotNil(config.Load(path))
+}
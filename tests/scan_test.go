@@ -0,0 +1,45 @@
+package file_cleaner
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	fsys := newTestMemFS(t, map[string]string{
+		"a/1.txt":     "same",
+		"a/sub/2.txt": "same",
+		"b/3.txt":     "same",
+		"b/4.txt":     "diff",
+		"b/5.txt":     "longer",
+		"b/6.txt":     "longer",
+		"b/7.txt":     "unique",
+	})
+
+	// b is listed twice, its files are not duplicates of themselves
+	dirs := []file_cleaner.DirEntry{
+		file_cleaner.CreateDirEntry("/a", true),
+		file_cleaner.CreateDirEntry("/b", true),
+		file_cleaner.CreateDirEntry("/b", false),
+	}
+	sets, err := file_cleaner.FindDuplicates(context.Background(), fsys, dirs)
+	assert.Nil(err)
+	assert.Equal([]file_cleaner.DuplicateSet{
+		{Size: 6, Files: []string{"/b/5.txt", "/b/6.txt"}},
+		{Size: 4, Files: []string{"/a/1.txt", "/a/sub/2.txt", "/b/3.txt"}},
+	}, sets)
+
+	var output strings.Builder
+	assert.Nil(file_cleaner.WriteFdupes(&output, sets, false))
+	assert.Equal("/b/5.txt\n/b/6.txt\n\n/a/1.txt\n/a/sub/2.txt\n/b/3.txt\n\n", output.String())
+
+	output.Reset()
+	assert.Nil(file_cleaner.WriteFdupes(&output, sets[:1], true))
+	assert.Equal("6 bytes each:\n/b/5.txt\n/b/6.txt\n\n", output.String())
+}
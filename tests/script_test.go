@@ -0,0 +1,148 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptOfDryRun writes the script of a dry run of dir/source against dir/target to dir/actions.sh
+func scriptOfDryRun(t *testing.T, dir string) (*file_cleaner.Report, string) {
+	target := file_cleaner.NewDirEntry(filepath.Join(dir, "target"), true)
+	source := file_cleaner.NewDirEntry(filepath.Join(dir, "source"), true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, filepath.Join(dir, "trash"))
+	assert.Nil(t, err)
+	config := file_cleaner.NewConfig()
+	assert.Nil(t, config.AddStrategy("test", strategy))
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true, ReplaceAsSymlink: true})
+	assert.Nil(t, err)
+
+	var script strings.Builder
+	assert.Nil(t, report.WriteScript(&script))
+	path := filepath.Join(dir, "actions.sh")
+	assert.Nil(t, os.WriteFile(path, []byte(script.String()), 0755))
+	return report, path
+}
+
+// test the script of a dry run does what the real run does, paths with quotes and spaces included
+func TestWriteScript(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	dir := t.TempDir()
+	now := time.Now()
+	writeTestFile(t, filepath.Join(dir, "target", "a.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dir, "target", "b.txt"), "other", now)
+	writeTestFile(t, filepath.Join(dir, "source", "it's a copy.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dir, "source", "$(b).txt"), "other", now)
+
+	report, path := scriptOfDryRun(t, dir)
+	actions := report.Strategies[0].Actions
+	assert.Len(actions, 6)
+	assert.Equal(file_cleaner.ActionMkdir, actions[0].Kind)
+	assert.Equal(file_cleaner.ActionMove, actions[1].Kind)
+	assert.Equal(file_cleaner.ActionSymlink, actions[2].Kind)
+
+	script, err := os.ReadFile(path)
+	assert.Nil(err)
+	assert.Contains(string(script), `/it'\''s a copy.txt'`)
+	assert.FileExists(filepath.Join(dir, "source", "it's a copy.txt"))
+
+	if _, err := exec.LookPath("cmp"); err != nil {
+		t.Skip("cmp not found")
+	}
+	output, err := exec.Command("sh", path).CombinedOutput()
+	assert.Nil(err, string(output))
+	assert.Len(report.Strategies[0].Entries, 2)
+	for _, entry := range report.Strategies[0].Entries {
+		assert.FileExists(entry.TrashPath)
+		link, err := os.Readlink(entry.Path)
+		assert.Nil(err)
+		assert.Equal(entry.Keep, link)
+	}
+}
+
+// test a file changed after the dry run stops the script before it is moved
+func TestWriteScriptChanged(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+	if _, err := exec.LookPath("cmp"); err != nil {
+		t.Skip("cmp not found")
+	}
+
+	dir := t.TempDir()
+	now := time.Now()
+	writeTestFile(t, filepath.Join(dir, "target", "a.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dir, "source", "copy.txt"), "same", now)
+	_, path := scriptOfDryRun(t, dir)
+
+	writeTestFile(t, filepath.Join(dir, "target", "a.txt"), "edit", now)
+	output, err := exec.Command("sh", path).CombinedOutput()
+	assert.NotNil(err)
+	assert.Contains(string(output), "stopped")
+	assert.FileExists(filepath.Join(dir, "source", "copy.txt"))
+}
+
+// test the script of a dry run with ingest moves the unique files as the real run does
+func TestWriteScriptIngest(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+	if _, err := exec.LookPath("cmp"); err != nil {
+		t.Skip("cmp not found")
+	}
+
+	dir := t.TempDir()
+	inbox := filepath.Join(dir, "inbox")
+	writeIngestFile(t, filepath.Join(dir, "target", "a.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "source", "copy.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "source", "paper.pdf"), "paper")
+	writeIngestFile(t, filepath.Join(dir, "source", "notes.md"), "notes")
+	writeIngestFile(t, filepath.Join(inbox, "md", "notes.md"), "notes")
+
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":    "source_to_target_dedupe",
+		"target_dir":  map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{map[string]interface{}{"path": filepath.Join(dir, "source"), "recursive": true}},
+		"ingest":      map[string]interface{}{"dir": inbox, "collision": "replace_if_identical"},
+	})
+	assert.Nil(err)
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true})
+	assert.Nil(err)
+	strategy := report.Strategies[0]
+	assert.Equal(2, strategy.Count(file_cleaner.ReportIngest))
+	// the duplicate, the replaced file and two ingested files, each with its mkdir
+	assert.Len(strategy.Actions, 8)
+
+	var script strings.Builder
+	assert.Nil(report.WriteScript(&script))
+	path := filepath.Join(dir, "actions.sh")
+	assert.Nil(os.WriteFile(path, []byte(script.String()), 0755))
+	output, err := exec.Command("sh", path).CombinedOutput()
+	assert.Nil(err, string(output))
+
+	assert.NoFileExists(filepath.Join(dir, "source", "copy.txt"))
+	assert.NoFileExists(filepath.Join(dir, "source", "paper.pdf"))
+	assert.NoFileExists(filepath.Join(dir, "source", "notes.md"))
+	content, err := os.ReadFile(filepath.Join(inbox, "pdf", "paper.pdf"))
+	assert.Nil(err)
+	assert.Equal("paper", string(content))
+	assert.FileExists(filepath.Join(inbox, "md", "notes.md"))
+	for _, entry := range strategy.Entries {
+		if entry.TrashPath != "" {
+			assert.FileExists(entry.TrashPath)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package file_cleaner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	assert := assert.New(t)
+	var output bytes.Buffer
+	file_cleaner.SetOutput(&output)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	fsys := newTestMemFS(t, map[string]string{
+		"target/a.txt": "aaaa",
+		"target/b.txt": "bbbbbbbb",
+		"target/c.txt": "cc",
+		"src1/x/a1":    "aaaa",
+		"src1/x/a2":    "aaaa",
+		"src1/y/b":     "bbbbbbbb",
+		"src1/u":       "zz",
+		"src1/v":       "12345",
+		"src2/d":       "cc",
+	})
+	target := file_cleaner.CreateDirEntry("/target", true)
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	for _, name := range []string{"src1", "src2"} {
+		source := file_cleaner.CreateDirEntry("/"+name, true)
+		strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy(name, []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+		assert.Nil(err)
+		assert.Nil(config.AddStrategy(name, strategy))
+	}
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true})
+	assert.Nil(err)
+
+	stats := report.Strategies[0].Stats
+	assert.Equal(8, stats.FilesScanned)
+	assert.Equal(int64(37), stats.BytesScanned)
+	assert.Equal(4, stats.SizeBuckets)
+	assert.Equal(4, stats.SizeCollisions)
+	// each file of a size collision is hashed once, comparing the content is not counted
+	assert.Equal(int64(32), stats.BytesHashed)
+	assert.Equal(2, stats.DuplicateGroups)
+	assert.Equal(3, stats.Duplicates)
+	assert.Equal(int64(16), stats.BytesReclaimed)
+	assert.Equal("/src1/y/b", stats.LargestDuplicates[0].Path)
+	assert.Equal([]file_cleaner.DirStat{{Dir: "/src1/x", Files: 2, Size: 8}, {Dir: "/src1/y", Files: 1, Size: 8}}, stats.TopDirs)
+
+	assert.Equal(4, report.Total.Duplicates)
+	assert.Equal(3, report.Total.DuplicateGroups)
+	assert.Equal(int64(18), report.Total.BytesReclaimed)
+	assert.Len(report.Total.TopDirs, 3)
+
+	output.Reset()
+	report.Print()
+	assert.Contains(output.String(), "Total:")
+	assert.Contains(output.String(), "Bytes reclaimed: 18 B")
+}
+
+// the paranoid re-check before each move does not add to the hashed bytes
+func TestStatsBytesHashed(t *testing.T) {
+	assert := assert.New(t)
+	var output bytes.Buffer
+	file_cleaner.SetOutput(&output)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	fsys := newTestMemFS(t, map[string]string{
+		"target/a.txt": "aaaa",
+		"source/a.txt": "aaaa",
+	})
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(err)
+	assert.Nil(strategy.SetVerify(file_cleaner.VerifyParanoid))
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	assert.Nil(config.AddStrategy("test", strategy))
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: false})
+	assert.Nil(err)
+	assert.Equal(1, report.Strategies[0].Stats.Duplicates)
+	assert.Equal(int64(8), report.Strategies[0].Stats.BytesHashed)
+}
+
+// test the names of a hardlinked source file count as duplicates, its space is reclaimed once
+func TestStatsHardlinkReclaimed(t *testing.T) {
+	skipWithoutHardlinks(t)
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "a.txt"), "0123456789")
+	writeIngestFile(t, filepath.Join(dir, "source", "s.txt"), "0123456789")
+	assert.Nil(os.Link(filepath.Join(dir, "source", "s.txt"), filepath.Join(dir, "source", "t.txt")))
+
+	for _, dryRun := range []bool{true, false} {
+		stats := runDedupe(t, dir, dryRun).Stats
+		assert.Equal(2, stats.Duplicates)
+		assert.Equal(int64(10), stats.BytesReclaimed)
+	}
+}
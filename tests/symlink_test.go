@@ -0,0 +1,92 @@
+package file_cleaner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// runSymlinkPolicy runs a dedupe of dir/source into dir/target, the source lists symlinks with the given policy
+func runSymlinkPolicy(t *testing.T, dir string, policy file_cleaner.SymlinkPolicy) *file_cleaner.StrategyReport {
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "target"), 0755))
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":   "source_to_target_dedupe",
+		"target_dir": map[string]interface{}{"path": filepath.Join(dir, "target"), "recursive": true},
+		"trash_dir":  filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{
+			map[string]interface{}{"path": filepath.Join(dir, "source"), "recursive": true, "symlinks": string(policy)},
+		},
+	})
+	assert.NoError(t, err)
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: false})
+	assert.NoError(t, err)
+	return report.Strategies[0]
+}
+
+func TestSymlinkAsLink(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "a.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "outside", "copy.txt"), "same")
+	link := filepath.Join(dir, "source", "link.txt")
+	assert.NoError(os.MkdirAll(filepath.Dir(link), 0755))
+	assert.NoError(os.Symlink(filepath.Join(dir, "outside", "copy.txt"), link))
+
+	// the link is listed, but it is never a duplicate candidate
+	source := file_cleaner.CreateDirEntry(filepath.Join(dir, "source"), true)
+	assert.NoError(source.SetSymlinkPolicy(file_cleaner.SymlinkAsLink))
+	sizeIndex, fileMap := file_cleaner.ListFiles(source)
+	assert.Empty(sizeIndex)
+	entry, ok := fileMap[link]
+	assert.True(ok)
+	assert.True(entry.IsSymlink())
+
+	report := runSymlinkPolicy(t, dir, file_cleaner.SymlinkAsLink)
+	assert.Empty(report.Entries)
+	info, err := os.Lstat(link)
+	assert.NoError(err)
+	assert.NotZero(info.Mode() & os.ModeSymlink)
+	assert.FileExists(filepath.Join(dir, "outside", "copy.txt"))
+}
+
+func TestSymlinkFollowIntoTarget(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target", "a.txt")
+	writeIngestFile(t, target, "same")
+	link := filepath.Join(dir, "source", "link.txt")
+	assert.NoError(os.MkdirAll(filepath.Dir(link), 0755))
+	assert.NoError(os.Symlink(target, link))
+
+	// the followed link is the target itself, neither the link nor the target may be trashed
+	report := runSymlinkPolicy(t, dir, file_cleaner.SymlinkFollow)
+	assert.Equal(0, report.Count(file_cleaner.ReportDuplicate))
+	info, err := os.Lstat(link)
+	assert.NoError(err)
+	assert.NotZero(info.Mode() & os.ModeSymlink)
+	content, err := os.ReadFile(target)
+	assert.NoError(err)
+	assert.Equal("same", string(content))
+	assert.Empty(manifests(t, filepath.Join(dir, "trash")))
+}
+
+// a followed link into the target is skipped, it is no existing hardlink
+func TestSymlinkFollowNotHardlink(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "a.txt"), "same")
+	writeIngestFile(t, filepath.Join(dir, "target", "b.txt"), "same")
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "source"), 0755))
+	assert.NoError(os.Symlink(filepath.Join(dir, "target", "b.txt"), filepath.Join(dir, "source", "link.txt")))
+
+	report := runSymlinkPolicy(t, dir, file_cleaner.SymlinkFollow)
+	assert.Equal(0, report.Count(file_cleaner.ReportHardlink))
+	assert.Equal(0, report.Count(file_cleaner.ReportDuplicate))
+	assert.Empty(report.Entries)
+	assert.FileExists(filepath.Join(dir, "source", "link.txt"))
+}
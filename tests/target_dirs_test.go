@@ -0,0 +1,105 @@
+package file_cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadStrategyConfig writes a config with a single strategy entry and loads it
+func loadStrategyConfig(t *testing.T, dir string, strategy map[string]interface{}) (file_cleaner.Config, error) {
+	data, err := json.Marshal(map[string]interface{}{"version": "0.1", "dedupe": strategy})
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "config.json")
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+
+	var config file_cleaner.Config
+	return config, config.Load(path)
+}
+
+func writeTargetDirsTree(t *testing.T, dir string) {
+	for path, content := range map[string]string{
+		"docs/report.txt":    "report",
+		"photos/image.jpg":   "image",
+		"photos/sub/old.jpg": "old",
+		"source/report.txt":  "report",
+		"source/image.jpg":   "image",
+		"source/old.jpg":     "old",
+	} {
+		path = filepath.Join(dir, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestTargetDirsMerged(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTargetDirsTree(t, dir)
+
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy": "source_to_target_dedupe",
+		"target_dirs": []interface{}{
+			map[string]interface{}{"path": filepath.Join(dir, "docs"), "recursive": true},
+			map[string]interface{}{"path": filepath.Join(dir, "photos"), "recursive": true},
+			// overlaps the previous target, its files must be indexed once
+			map[string]interface{}{"path": filepath.Join(dir, "photos", "sub"), "recursive": true},
+		},
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{map[string]interface{}{"path": filepath.Join(dir, "source"), "recursive": true}},
+	})
+	assert.NoError(err)
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true})
+	assert.NoError(err)
+	strategy := report.Strategies[0]
+	assert.Equal(3, strategy.Count(file_cleaner.ReportDuplicate))
+
+	roots := make(map[string]string)
+	for _, entry := range strategy.Entries {
+		roots[filepath.Base(entry.Path)] = entry.KeepRoot
+	}
+	assert.Equal(filepath.Join(dir, "docs"), roots["report.txt"])
+	assert.Equal(filepath.Join(dir, "photos"), roots["image.jpg"])
+	assert.Equal(filepath.Join(dir, "photos"), roots["old.jpg"])
+}
+
+func TestTargetDirsOwnFilters(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTargetDirsTree(t, dir)
+
+	// the legacy target_dir is merged with target_dirs, each target keeps its own ignore
+	config, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":   "source_to_target_dedupe",
+		"target_dir": map[string]interface{}{"path": filepath.Join(dir, "docs"), "recursive": true, "ignore": ".*\\.txt"},
+		"target_dirs": []interface{}{
+			map[string]interface{}{"path": filepath.Join(dir, "photos"), "recursive": false},
+		},
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{map[string]interface{}{"path": filepath.Join(dir, "source"), "recursive": true}},
+	})
+	assert.NoError(err)
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{DryRun: true})
+	assert.NoError(err)
+	strategy := report.Strategies[0]
+	assert.Equal(1, strategy.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(filepath.Join(dir, "source", "image.jpg"), strategy.Entries[0].Path)
+	assert.Equal(filepath.Join(dir, "photos"), strategy.Entries[0].KeepRoot)
+}
+
+func TestTargetDirsRequired(t *testing.T) {
+	dir := t.TempDir()
+	_, err := loadStrategyConfig(t, dir, map[string]interface{}{
+		"strategy":    "source_to_target_dedupe",
+		"trash_dir":   filepath.Join(dir, "trash"),
+		"source_dirs": []interface{}{},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package file_cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// create a file with the given content and modification time
+func writeTestFile(t *testing.T, path string, content string, modTime time.Time) file_cleaner.FileEntry {
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+
+	var entry file_cleaner.FileEntry
+	assert.Nil(t, entry.Load(path))
+	return entry
+}
+
+func TestPathTemplateExpand(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	entry := writeTestFile(t, filepath.Join(dir, "Paper.PDF"), "hello\n", time.Date(2024, 5, 7, 0, 0, 0, 0, time.Local))
+
+	template, err := file_cleaner.ParsePathTemplate("{year}/{month}/{day}/{ext}/{stem}-{hash8}/{name}")
+	assert.Nil(err)
+	path, err := template.Expand(&entry, file_cleaner.TemplateFields{})
+	assert.Nil(err)
+	assert.Equal(filepath.Join("2024", "05", "07", "pdf", "Paper-b1946ac9", "Paper.PDF"), path)
+
+	template, err = file_cleaner.ParsePathTemplate("{rule}/{dir}/{name}")
+	assert.Nil(err)
+	path, err = template.Expand(&entry, file_cleaner.TemplateFields{Rule: "papers", Dir: "a/b"})
+	assert.Nil(err)
+	assert.Equal(filepath.Join("papers", "a", "b", "Paper.PDF"), path)
+
+	// files without extension
+	entry = writeTestFile(t, filepath.Join(dir, "README"), "readme", time.Now())
+	template, _ = file_cleaner.ParsePathTemplate("{ext}/{stem}")
+	path, _ = template.Expand(&entry, file_cleaner.TemplateFields{})
+	assert.Equal(filepath.Join("no_extension", "README"), path)
+
+	// the result never leaves the destination
+	template, _ = file_cleaner.ParsePathTemplate("../{name}")
+	_, err = template.Expand(&entry, file_cleaner.TemplateFields{})
+	assert.NotNil(err)
+	template, _ = file_cleaner.ParsePathTemplate("{dir}/{name}")
+	_, err = template.Expand(&entry, file_cleaner.TemplateFields{Dir: "../.."})
+	assert.NotNil(err)
+}
+
+func TestParsePathTemplateInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, raw := range []string{"", "{year", "year}", "{unknown}/{name}", "/abs/{name}"} {
+		_, err := file_cleaner.ParsePathTemplate(raw)
+		assert.NotNil(err, raw)
+	}
+}
+
+func TestMoverResolve(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	now := time.Now()
+	entry := writeTestFile(t, filepath.Join(dir, "src", "a.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dir, "dst", "a.txt"), "same", now)
+	writeTestFile(t, filepath.Join(dir, "dst", "a_1.txt"), "other", now)
+	notTaken := func(string) bool { return false }
+	destination := filepath.Join(dir, "dst", "a.txt")
+
+	mover, err := file_cleaner.NewMover(filepath.Join(dir, "dst"), "{name}", file_cleaner.CollisionSkip)
+	assert.Nil(err)
+	_, _, ok := mover.Resolve(&entry, destination, notTaken)
+	assert.False(ok)
+
+	mover, _ = file_cleaner.NewMover(filepath.Join(dir, "dst"), "{name}", file_cleaner.CollisionSuffix)
+	final, replace, ok := mover.Resolve(&entry, destination, notTaken)
+	assert.True(ok)
+	assert.False(replace)
+	assert.Equal(filepath.Join(dir, "dst", "a_2.txt"), final)
+
+	mover, _ = file_cleaner.NewMover(filepath.Join(dir, "dst"), "{name}", file_cleaner.CollisionReplaceIfIdentical)
+	final, replace, ok = mover.Resolve(&entry, destination, notTaken)
+	assert.True(ok)
+	assert.True(replace)
+	assert.Equal(destination, final)
+
+	// a different file is never replaced
+	_, _, ok = mover.Resolve(&entry, filepath.Join(dir, "dst", "a_1.txt"), notTaken)
+	assert.False(ok)
+
+	_, err = file_cleaner.NewMover(dir, "{name}", "overwrite")
+	assert.NotNil(err)
+}
@@ -0,0 +1,73 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// test the symlink and the trashed file of a session are restored in reverse order
+func TestRestore(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	fsys := newTestMemFS(t, map[string]string{
+		"target/a.txt":    "same",
+		"target/b.txt":    "other",
+		"source/copy.txt": "same",
+		"source/b.txt":    "other",
+	})
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(err)
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	assert.Nil(config.AddStrategy("test", strategy))
+	assert.Equal([]string{"/trash"}, config.TrashRoots())
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{ReplaceAsSymlink: true})
+	assert.Nil(err)
+	assert.Equal(2, report.Strategies[0].Count(file_cleaner.ReportDuplicate))
+
+	sessions, err := file_cleaner.TrashSessions(fsys, "/trash")
+	assert.Nil(err)
+	assert.Len(sessions, 1)
+	assert.Equal(report.Strategies[0].TrashDir, sessions[0].Path)
+	assert.Len(sessions[0].Records, 4)
+
+	// restore a single file, the symlink in its place is removed first
+	restored, err := file_cleaner.Restore(fsys, sessions[0].Path, []string{"/source/copy.txt"})
+	assert.Nil(err)
+	assert.Len(restored, 2)
+	assert.Equal(file_cleaner.ManifestSymlink, restored[0].Action)
+	content, err := fs.ReadFile(fsys, "source/copy.txt")
+	assert.Nil(err)
+	assert.Equal("same", string(content))
+	_, err = fsys.ReadLink("source/b.txt")
+	assert.Nil(err)
+
+	// a second restore only restores what is left
+	restored, err = file_cleaner.Restore(fsys, sessions[0].Path, nil)
+	assert.Nil(err)
+	assert.Len(restored, 2)
+	content, err = fs.ReadFile(fsys, "source/b.txt")
+	assert.Nil(err)
+	assert.Equal("other", string(content))
+
+	restored, err = file_cleaner.Restore(fsys, sessions[0].Path, nil)
+	assert.Nil(err)
+	assert.Empty(restored)
+
+	// no trash dir, no sessions
+	sessions, err = file_cleaner.TrashSessions(fsys, "/missing")
+	assert.Nil(err)
+	assert.Empty(sessions)
+}
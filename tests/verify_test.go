@@ -0,0 +1,162 @@
+package file_cleaner
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// hookFS calls onOpen before each Open, so a test can change files between scan and action
+type hookFS struct {
+	file_cleaner.FileSystem
+	onOpen func(name string)
+}
+
+func (fsys hookFS) Open(name string) (fs.File, error) {
+	fsys.onOpen(name)
+	return fsys.FileSystem.Open(name)
+}
+
+func runVerify(t *testing.T, mode file_cleaner.VerifyMode, fsys file_cleaner.FileSystem) *file_cleaner.StrategyReport {
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(t, err)
+	assert.Nil(t, strategy.SetVerify(mode))
+
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	assert.Nil(t, config.AddStrategy("test", strategy))
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{})
+	assert.Nil(t, err)
+	return report.Strategies[0]
+}
+
+func TestVerifyMode(t *testing.T) {
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	for _, mode := range []file_cleaner.VerifyMode{file_cleaner.VerifySizeHash, file_cleaner.VerifyHashBytes, file_cleaner.VerifyParanoid} {
+		fsys := newTestMemFS(t, map[string]string{"target/a.txt": "same", "source/copy.txt": "same", "source/other.txt": "diff"})
+		report := runVerify(t, mode, fsys)
+		assert.Equal(t, string(mode), report.Verify)
+		assert.Equal(t, 1, report.Count(file_cleaner.ReportDuplicate), mode)
+	}
+
+	var strategy file_cleaner.SourceToTargetDedupeStrategy
+	assert.NotNil(t, strategy.SetVerify("bytes"))
+}
+
+// test paranoid catches a file changed between scan and action
+func TestVerifyParanoidChanged(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	memfs := newTestMemFS(t, map[string]string{"target/a.txt": "same", "source/copy.txt": "same"})
+	opens := 0
+	fsys := hookFS{FileSystem: memfs, onOpen: func(name string) {
+		// the scan reads the file for the hash and the byte comparison, the third read is the check before the move
+		if name == "source/copy.txt" {
+			opens++
+			if opens == 3 {
+				assert.Nil(memfs.WriteFile(name, []byte("edit"), 0644))
+			}
+		}
+	}}
+
+	report := runVerify(t, file_cleaner.VerifyParanoid, fsys)
+	assert.Equal(0, report.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(1, report.Count(file_cleaner.ReportChanged))
+	content, err := fs.ReadFile(memfs, "source/copy.txt")
+	assert.Nil(err)
+	assert.Equal("edit", string(content))
+}
+
+// test a file changed between scan and action is skipped, whichever verify mode is set
+func TestChangedBeforeAction(t *testing.T) {
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	tests := map[string]func(t *testing.T, memfs *file_cleaner.MemFS){
+		"source mtime": func(t *testing.T, memfs *file_cleaner.MemFS) {
+			assert.Nil(t, memfs.Chtimes("source/copy.txt", time.Now().Add(time.Hour)))
+		},
+		"target mtime": func(t *testing.T, memfs *file_cleaner.MemFS) {
+			assert.Nil(t, memfs.Chtimes("target/a.txt", time.Now().Add(time.Hour)))
+		},
+	}
+
+	for name, change := range tests {
+		change := change
+		t.Run(name, func(t *testing.T) {
+			memfs := newTestMemFS(t, map[string]string{"target/a.txt": "same", "source/copy.txt": "same"})
+			opens := 0
+			fsys := hookFS{FileSystem: memfs, onOpen: func(name string) {
+				// the second read of the source is the byte comparison, the last read of the scan
+				if name == "source/copy.txt" {
+					opens++
+					if opens == 2 {
+						change(t, memfs)
+					}
+				}
+			}}
+
+			report := runVerify(t, file_cleaner.VerifyHashBytes, fsys)
+			assert.Equal(t, 0, report.Count(file_cleaner.ReportDuplicate))
+			assert.Equal(t, 1, report.Count(file_cleaner.ReportChanged))
+			_, err := memfs.Stat("source/copy.txt")
+			assert.Nil(t, err)
+		})
+	}
+}
+
+// test a kept file replaced by a copy with the same size and mtime is detected by its inode
+func TestChangedInode(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	root := fixture{files: map[string]string{"target/a.txt": "same", "source/copy.txt": "same"}}.build(t)
+	target := filepath.Join(root, "target", "a.txt")
+	info, err := os.Stat(target)
+	assert.Nil(err)
+	if runtime.GOOS == "windows" {
+		t.Skip("the platform does not report inodes")
+	}
+
+	opens := 0
+	fsys := hookFS{FileSystem: file_cleaner.OSFS{}, onOpen: func(name string) {
+		if name == file_cleaner.FSName(filepath.Join(root, "source", "copy.txt")) {
+			opens++
+			if opens == 2 {
+				replacement := filepath.Join(root, "a.txt.new")
+				assert.Nil(os.WriteFile(replacement, []byte("same"), 0644))
+				assert.Nil(os.Chtimes(replacement, info.ModTime(), info.ModTime()))
+				assert.Nil(os.Rename(replacement, target))
+			}
+		}
+	}}
+
+	dirs := func(name string) []file_cleaner.DirEntry {
+		return []file_cleaner.DirEntry{file_cleaner.CreateDirEntry(filepath.Join(root, name), true)}
+	}
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", dirs("target"), dirs("source"), filepath.Join(root, "trash"))
+	assert.Nil(err)
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	assert.Nil(config.AddStrategy("test", strategy))
+
+	report, err := config.Execute(context.Background(), file_cleaner.CmdLineArgs{})
+	assert.Nil(err)
+	assert.Equal(1, report.Strategies[0].Count(file_cleaner.ReportChanged))
+	assert.FileExists(filepath.Join(root, "source", "copy.txt"))
+}
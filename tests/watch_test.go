@@ -0,0 +1,115 @@
+package file_cleaner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/stretchr/testify/assert"
+)
+
+const watchDebounce = 50 * time.Millisecond
+
+// startWatch runs Watch in the background, the returned function stops it and returns the report
+func startWatch(t *testing.T, dir string) func() *file_cleaner.Report {
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "target"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "source"), 0755))
+	var config file_cleaner.Config
+	assert.NoError(t, config.Load(writeDedupeConfig(t, dir)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *file_cleaner.Report)
+	go func() {
+		report, err := config.Watch(ctx, file_cleaner.CmdLineArgs{}, watchDebounce)
+		assert.NoError(t, err)
+		done <- report
+	}()
+
+	// give the watcher time to add the directories
+	time.Sleep(4 * watchDebounce)
+	return func() *file_cleaner.Report {
+		cancel()
+		return <-done
+	}
+}
+
+func TestWatchDuplicate(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "paper.pdf"), "paper")
+	stop := startWatch(t, dir)
+
+	path := filepath.Join(dir, "source", "paper.pdf")
+	writeIngestFile(t, path, "paper")
+	assert.Eventually(func() bool {
+		_, err := os.Lstat(path)
+		return os.IsNotExist(err)
+	}, 40*watchDebounce, watchDebounce/2)
+
+	report := stop()
+	assert.Equal(1, report.Strategies[0].Count(file_cleaner.ReportDuplicate))
+}
+
+func TestWatchDebounce(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeIngestFile(t, filepath.Join(dir, "target", "paper.pdf"), "paper")
+	stop := startWatch(t, dir)
+
+	// a file that keeps changing is not processed, even once its content matches a target
+	path := filepath.Join(dir, "source", "paper.pdf")
+	for i := 0; i < 10; i++ {
+		writeIngestFile(t, path, "paper")
+		time.Sleep(watchDebounce / 3)
+		assert.FileExists(path)
+	}
+
+	// partial downloads are never processed
+	partial := filepath.Join(dir, "source", "paper.pdf.part")
+	writeIngestFile(t, partial, "paper")
+
+	assert.Eventually(func() bool {
+		_, err := os.Lstat(path)
+		return os.IsNotExist(err)
+	}, 40*watchDebounce, watchDebounce/2)
+
+	report := stop()
+	assert.Equal(1, report.Strategies[0].Count(file_cleaner.ReportDuplicate))
+	assert.FileExists(partial)
+}
+
+func TestWatchTargetIndexUpdated(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	removed := filepath.Join(dir, "target", "removed.txt")
+	writeIngestFile(t, removed, "removed")
+	stop := startWatch(t, dir)
+
+	// a new target file is indexed, a removed one is dropped from the index
+	writeIngestFile(t, filepath.Join(dir, "target", "sub", "added.txt"), "added")
+	assert.NoError(os.Remove(removed))
+	time.Sleep(4 * watchDebounce)
+
+	writeIngestFile(t, filepath.Join(dir, "source", "removed.txt"), "removed")
+	added := filepath.Join(dir, "source", "added.txt")
+	writeIngestFile(t, added, "added")
+	assert.Eventually(func() bool {
+		_, err := os.Lstat(added)
+		return os.IsNotExist(err)
+	}, 40*watchDebounce, watchDebounce/2)
+
+	report := stop()
+	strategy := report.Strategies[0]
+	assert.Equal(1, strategy.Count(file_cleaner.ReportDuplicate))
+	assert.Equal(filepath.Join(dir, "target", "sub", "added.txt"), strategy.Entries[0].Keep)
+	assert.FileExists(filepath.Join(dir, "source", "removed.txt"))
+}
+
+func TestWatchDebounceRequired(t *testing.T) {
+	var config file_cleaner.Config
+	_, err := config.Watch(context.Background(), file_cleaner.CmdLineArgs{}, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+package file_cleaner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+	"github.com/r888800009/file_cleaner/web"
+	"github.com/stretchr/testify/assert"
+)
+
+// request sends the value as JSON and decodes the response into result, it returns the status code
+func request(t *testing.T, method string, url string, value interface{}, result interface{}) int {
+	var body io.Reader
+	if value != nil {
+		data, err := json.Marshal(value)
+		assert.Nil(t, err)
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, body)
+	assert.Nil(t, err)
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	if result != nil {
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(result))
+	}
+	return response.StatusCode
+}
+
+// test scan, review, apply and restore through the API
+func TestWebServer(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	fsys := newTestMemFS(t, map[string]string{
+		"target/a.txt":  "same",
+		"target/b.txt":  "other",
+		"source/a.txt":  "same",
+		"source/b2.txt": "other",
+	})
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(err)
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	assert.Nil(config.AddStrategy("test", strategy))
+
+	server := httptest.NewServer(web.New(config, file_cleaner.CmdLineArgs{}, nil, "").Handler())
+	defer server.Close()
+
+	// the embedded web UI
+	response, err := http.Get(server.URL + "/")
+	assert.Nil(err)
+	page, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Contains(string(page), "app.js")
+
+	assert.Equal(http.StatusNotFound, request(t, http.MethodGet, server.URL+"/api/plan", nil, nil))
+	assert.Equal(http.StatusMethodNotAllowed, request(t, http.MethodGet, server.URL+"/api/scan", nil, nil))
+
+	// a form post of another site is refused
+	response, err = http.Post(server.URL+"/api/scan", "text/plain", nil)
+	assert.Nil(err)
+	response.Body.Close()
+	assert.Equal(http.StatusUnsupportedMediaType, response.StatusCode)
+
+	// a scan is a dry run
+	var report file_cleaner.Report
+	assert.Equal(http.StatusOK, request(t, http.MethodPost, server.URL+"/api/scan", struct{}{}, &report))
+	assert.Equal(2, report.Strategies[0].Count(file_cleaner.ReportDuplicate))
+	_, err = fsys.Lstat("source/a.txt")
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, request(t, http.MethodGet, server.URL+"/api/report", nil, &report))
+
+	// unselect a.txt and apply
+	var plan file_cleaner.Plan
+	assert.Equal(http.StatusOK, request(t, http.MethodGet, server.URL+"/api/plan", nil, &plan))
+	assert.Len(plan.Groups, 2)
+	for i := range plan.Groups {
+		plan.Groups[i].Files[0].Selected = plan.Groups[i].Keep != "/target/a.txt"
+	}
+	assert.Equal(http.StatusOK, request(t, http.MethodPut, server.URL+"/api/plan", plan, &plan))
+
+	var applied file_cleaner.StrategyReport
+	assert.Equal(http.StatusOK, request(t, http.MethodPost, server.URL+"/api/apply", struct{}{}, &applied))
+	assert.Equal(1, applied.Count(file_cleaner.ReportDuplicate))
+	_, err = fsys.Lstat("source/a.txt")
+	assert.Nil(err)
+	_, err = fsys.Lstat("source/b2.txt")
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	// the trash session lists the move and restores it
+	var sessions []file_cleaner.TrashSession
+	assert.Equal(http.StatusOK, request(t, http.MethodGet, server.URL+"/api/sessions", nil, &sessions))
+	assert.Len(sessions, 1)
+	assert.Len(sessions[0].Records, 1)
+
+	assert.Equal(http.StatusBadRequest, request(t, http.MethodPost, server.URL+"/api/restore", web.RestoreRequest{Session: "/source"}, nil))
+	var restored []file_cleaner.ManifestRecord
+	assert.Equal(http.StatusOK, request(t, http.MethodPost, server.URL+"/api/restore", web.RestoreRequest{Session: sessions[0].Path}, &restored))
+	assert.Len(restored, 1)
+	_, err = fsys.Lstat("source/b2.txt")
+	assert.Nil(err)
+}
+
+func TestWebListen(t *testing.T) {
+	assert := assert.New(t)
+	_, err := web.Listen("0.0.0.0:0")
+	assert.NotNil(err)
+
+	listener, err := web.Listen("127.0.0.1:0")
+	assert.Nil(err)
+	listener.Close()
+}
+
+// a request for another host name is refused, it may come from a DNS rebinding page
+func TestWebHost(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(web.New(file_cleaner.NewConfig(), file_cleaner.CmdLineArgs{}, nil, "").Handler())
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.Nil(err)
+
+	for host, status := range map[string]int{
+		"evil.example:" + port:           http.StatusForbidden,
+		"evil.example":                   http.StatusForbidden,
+		"127.0.0.1.evil.example:" + port: http.StatusForbidden,
+		"0.0.0.0:" + port:                http.StatusForbidden,
+		server.Listener.Addr().String():  http.StatusNotFound,
+		"localhost:" + port:              http.StatusNotFound,
+		"LOCALHOST":                      http.StatusNotFound,
+		"127.0.0.2:" + port:              http.StatusNotFound,
+		"[::1]:" + port:                  http.StatusNotFound,
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/report", nil)
+		assert.Nil(err)
+		req.Host = host
+		response, err := http.DefaultClient.Do(req)
+		assert.Nil(err)
+		response.Body.Close()
+		assert.Equal(status, response.StatusCode, host)
+	}
+
+	// the handler checks the Host header, not the address it was reached on
+	recorder := httptest.NewRecorder()
+	web.New(file_cleaner.NewConfig(), file_cleaner.CmdLineArgs{}, nil, "").Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://evil.example/", nil))
+	assert.Equal(http.StatusForbidden, recorder.Code)
+}
+
+// a client can only change the selection, a plan that moves other files is never applied
+func TestWebPlanRefused(t *testing.T) {
+	assert := assert.New(t)
+	file_cleaner.SetOutput(io.Discard)
+	defer file_cleaner.SetOutput(os.Stdout)
+
+	fsys := newTestMemFS(t, map[string]string{"target/a.txt": "same", "source/a.txt": "same", "home/secret.txt": "same"})
+	target := file_cleaner.CreateDirEntry("/target", true)
+	source := file_cleaner.CreateDirEntry("/source", true)
+	strategy, err := file_cleaner.NewSourceToTargetDedupeStrategy("test", []file_cleaner.DirEntry{target}, []file_cleaner.DirEntry{source}, "/trash")
+	assert.Nil(err)
+	config := file_cleaner.NewConfig()
+	config.SetFS(fsys)
+	assert.Nil(config.AddStrategy("test", strategy))
+
+	server := httptest.NewServer(web.New(config, file_cleaner.CmdLineArgs{}, nil, "").Handler())
+	defer server.Close()
+	assert.Equal(http.StatusNotFound, request(t, http.MethodPut, server.URL+"/api/plan", file_cleaner.Plan{}, nil))
+	assert.Equal(http.StatusOK, request(t, http.MethodPost, server.URL+"/api/scan", struct{}{}, nil))
+
+	var plan file_cleaner.Plan
+	assert.Equal(http.StatusOK, request(t, http.MethodGet, server.URL+"/api/plan", nil, &plan))
+	assert.Len(plan.Groups, 1)
+	for name, change := range map[string]func(plan *file_cleaner.Plan){
+		"trash dir":  func(plan *file_cleaner.Plan) { plan.Groups[0].TrashDir = "/home/trash" },
+		"kept file":  func(plan *file_cleaner.Plan) { plan.Groups[0].Keep = "/source/a.txt" },
+		"added file": func(plan *file_cleaner.Plan) { plan.Groups[0].Files[0].Path = "/home/secret.txt" },
+	} {
+		changed := plan
+		changed.Groups = []file_cleaner.PlanGroup{plan.Groups[0]}
+		changed.Groups[0].Files = append([]file_cleaner.PlanFile{}, plan.Groups[0].Files...)
+		change(&changed)
+		assert.Equal(http.StatusBadRequest, request(t, http.MethodPut, server.URL+"/api/plan", changed, nil), name)
+	}
+
+	var applied file_cleaner.StrategyReport
+	assert.Equal(http.StatusOK, request(t, http.MethodPost, server.URL+"/api/apply", struct{}{}, &applied))
+	assert.Equal(1, applied.Count(file_cleaner.ReportDuplicate))
+	_, err = fsys.Lstat("home/secret.txt")
+	assert.Nil(err)
+
+	// a plan file from outside the config is refused by apply
+	plan = file_cleaner.Plan{Groups: []file_cleaner.PlanGroup{{
+		Keep: "/target/a.txt", KeepRoot: "/target", Size: 4, TrashDir: "/home/2024-05-01-12-00-00.000",
+		Files: []file_cleaner.PlanFile{{Path: "/home/secret.txt", Selected: true}},
+	}}}
+	loaded := httptest.NewServer(web.New(config, file_cleaner.CmdLineArgs{}, &plan, "").Handler())
+	defer loaded.Close()
+	assert.Equal(http.StatusBadRequest, request(t, http.MethodPost, loaded.URL+"/api/apply", struct{}{}, nil))
+	_, err = fsys.Lstat("home/secret.txt")
+	assert.Nil(err)
+}
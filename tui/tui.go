@@ -0,0 +1,268 @@
+/*
+Package tui is a terminal UI to review a Plan of duplicate groups before it is applied.
+It works on the structured results of the dedupe engine, a saved Report or Plan.
+*/
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+)
+
+// Model is the bubbletea model of the plan review
+type Model struct {
+	plan     *file_cleaner.Plan
+	planPath string
+
+	// visible are the indexes of the groups matching the filter
+	visible []int
+	cursor  int
+	offset  int
+	height  int
+
+	filter  string
+	editing bool
+	preview bool
+	confirm bool
+	apply   bool
+	status  string
+}
+
+// New creates the model, w saves the plan to planPath
+func New(plan *file_cleaner.Plan, planPath string) *Model {
+	model := &Model{plan: plan, planPath: planPath, height: 24}
+	model.applyFilter()
+	return model
+}
+
+// Plan returns the plan with the selections of the user
+func (model *Model) Plan() *file_cleaner.Plan {
+	return model.plan
+}
+
+// Apply returns true if the user confirmed to apply the plan
+func (model *Model) Apply() bool {
+	return model.apply
+}
+
+// Run shows the model until the user quits, it returns true if the plan should be applied
+func Run(plan *file_cleaner.Plan, planPath string) (bool, error) {
+	model := New(plan, planPath)
+	if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+		return false, err
+	}
+	return model.apply, nil
+}
+
+// matches returns true if the path matches the filter, a filter like .pdf matches the extension
+func (model *Model) matches(path string) bool {
+	if strings.HasPrefix(model.filter, ".") && !strings.ContainsAny(model.filter, `/\`) {
+		return strings.EqualFold(filepath.Ext(path), model.filter)
+	}
+	return strings.Contains(path, model.filter)
+}
+
+// applyFilter updates the visible groups and keeps the cursor inside them
+func (model *Model) applyFilter() {
+	model.visible = model.visible[:0]
+	for i, group := range model.plan.Groups {
+		match := model.filter == "" || model.matches(group.Keep)
+		for _, file := range group.Files {
+			match = match || model.matches(file.Path)
+		}
+		if match {
+			model.visible = append(model.visible, i)
+		}
+	}
+
+	if model.cursor >= len(model.visible) {
+		model.cursor = len(model.visible) - 1
+	}
+	if model.cursor < 0 {
+		model.cursor = 0
+	}
+}
+
+// current returns the group under the cursor, nil if no group is visible
+func (model *Model) current() *file_cleaner.PlanGroup {
+	if len(model.visible) == 0 {
+		return nil
+	}
+	return &model.plan.Groups[model.visible[model.cursor]]
+}
+
+// toggle selects all files of the group, or none if all are selected
+func toggle(group *file_cleaner.PlanGroup) {
+	selected := true
+	for _, file := range group.Files {
+		selected = selected && file.Selected
+	}
+	for i := range group.Files {
+		group.Files[i].Selected = !selected
+	}
+}
+
+func (model *Model) Init() tea.Cmd {
+	return nil
+}
+
+func (model *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		model.height = msg.Height
+	case tea.KeyMsg:
+		return model.updateKey(msg)
+	}
+	return model, nil
+}
+
+func (model *Model) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key == "ctrl+c" {
+		return model, tea.Quit
+	}
+
+	// typing the filter
+	if model.editing {
+		switch msg.Type {
+		case tea.KeyEnter:
+			model.editing = false
+		case tea.KeyEsc:
+			model.editing = false
+			model.filter = ""
+		case tea.KeyBackspace:
+			if model.filter != "" {
+				model.filter = model.filter[:len(model.filter)-1]
+			}
+		case tea.KeyRunes, tea.KeySpace:
+			model.filter += string(msg.Runes)
+		}
+		model.applyFilter()
+		return model, nil
+	}
+
+	// waiting for the confirmation to apply
+	if model.confirm {
+		model.confirm = false
+		if key == "y" {
+			model.apply = true
+			return model, tea.Quit
+		}
+		model.status = "Not applied"
+		return model, nil
+	}
+
+	model.status = ""
+	group := model.current()
+	switch key {
+	case "q", "esc":
+		return model, tea.Quit
+	case "up", "k":
+		if model.cursor > 0 {
+			model.cursor--
+		}
+	case "down", "j":
+		if model.cursor < len(model.visible)-1 {
+			model.cursor++
+		}
+	case " ":
+		if group != nil {
+			toggle(group)
+		}
+	case "enter", "p":
+		model.preview = !model.preview
+	case "/":
+		model.editing = true
+	case "w":
+		if err := model.plan.Save(model.planPath); err != nil {
+			model.status = "Error saving plan: " + err.Error()
+		} else {
+			model.status = "Saved " + model.planPath
+		}
+	case "a":
+		model.confirm = true
+	default:
+		// 1-9 toggles a single file of the previewed group
+		if model.preview && group != nil && len(key) == 1 && key[0] >= '1' && key[0] <= '9' {
+			if i := int(key[0] - '1'); i < len(group.Files) {
+				group.Files[i].Selected = !group.Files[i].Selected
+			}
+		}
+	}
+	return model, nil
+}
+
+// metadata returns the live size and modification time of the file
+func metadata(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%s, %s, %s", file_cleaner.FormatSize(info.Size()), info.Mode(), info.ModTime().Format("2006-01-02 15:04:05"))
+}
+
+func (model *Model) View() string {
+	var view strings.Builder
+	fmt.Fprintf(&view, "%d groups, %s selected of %d shown\n", len(model.plan.Groups), file_cleaner.FormatSize(model.plan.Reclaimable()), len(model.visible))
+	if model.editing || model.filter != "" {
+		fmt.Fprintf(&view, "Filter: %s\n", model.filter)
+	}
+
+	// the list and the preview share the lines left by the header and footer
+	lines := model.height - 6
+	group := model.current()
+	if model.preview && group != nil {
+		lines -= len(group.Files) + 2
+	}
+	if lines < 1 {
+		lines = 1
+	}
+	if model.cursor < model.offset {
+		model.offset = model.cursor
+	}
+	if model.cursor >= model.offset+lines {
+		model.offset = model.cursor - lines + 1
+	}
+
+	for i := model.offset; i < len(model.visible) && i < model.offset+lines; i++ {
+		shown := &model.plan.Groups[model.visible[i]]
+		cursor := "  "
+		if i == model.cursor {
+			cursor = "> "
+		}
+		mark := "[ ]"
+		if shown.Reclaimable() > 0 {
+			mark = "[x]"
+		}
+		fmt.Fprintf(&view, "%s%s %10s  %s (%d duplicates)\n", cursor, mark, file_cleaner.FormatSize(shown.Reclaimable()), shown.Keep, len(shown.Files))
+	}
+
+	if model.preview && group != nil {
+		fmt.Fprintf(&view, "\nkeep  %s (%s)\n", group.Keep, metadata(group.Keep))
+		for i, file := range group.Files {
+			mark := "[ ]"
+			if file.Selected {
+				mark = "[x]"
+			}
+			fmt.Fprintf(&view, "%d %s %s (%s)\n", i+1, mark, file.Path, metadata(file.Path))
+		}
+	}
+
+	view.WriteString("\n")
+	switch {
+	case model.confirm:
+		fmt.Fprintf(&view, "Apply the plan and move %s to trash? y/n", file_cleaner.FormatSize(model.plan.Reclaimable()))
+	case model.editing:
+		view.WriteString("Type a path or an extension such as .pdf, enter keeps the filter, esc clears it")
+	case model.status != "":
+		view.WriteString(model.status)
+	default:
+		view.WriteString("up/down move, space toggle, enter preview, 1-9 toggle file, / filter, w save, a apply, q quit")
+	}
+	return view.String()
+}
@@ -0,0 +1,353 @@
+/*
+Package web serves a JSON API and a small web UI to scan, review and apply a Plan
+and to restore trash sessions. It is meant for the loopback interface only.
+*/
+package web
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	file_cleaner "github.com/r888800009/file_cleaner/core"
+)
+
+//go:embed static
+var static embed.FS
+
+/*
+Server holds the config and the last scan. Scans, applies and restores run one at a time,
+a scan is always a dry run, cmd is used to apply the plan.
+*/
+type Server struct {
+	config   *file_cleaner.Config
+	cmd      file_cleaner.CmdLineArgs
+	planPath string
+
+	mutex  sync.Mutex
+	report *file_cleaner.Report
+	plan   *file_cleaner.Plan
+}
+
+// RestoreRequest is the body of POST /api/restore, all files of the session are restored if Paths is empty
+type RestoreRequest struct {
+	Session string   `json:"session"`
+	Paths   []string `json:"paths"`
+}
+
+/*
+New creates the server, plan is the plan to start with and may be nil.
+The plan is saved to planPath after each change if planPath is not empty.
+*/
+func New(config *file_cleaner.Config, cmd file_cleaner.CmdLineArgs, plan *file_cleaner.Plan, planPath string) *Server {
+	return &Server{config: config, cmd: cmd, plan: plan, planPath: planPath}
+}
+
+// Listen listens on addr, it refuses addresses other than the loopback interface
+func Listen(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !loopbackHost(host) {
+		return nil, fmt.Errorf("not a loopback address: %s", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// loopbackHost returns true if host, with or without port, is localhost or a loopback IP
+func loopbackHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+/*
+checkHost refuses a request whose Host is not a loopback address. A page of another site can
+resolve its own name to 127.0.0.1 (DNS rebinding), its requests then carry that name as Host.
+*/
+func checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !loopbackHost(request.Host) {
+			writeError(writer, http.StatusForbidden, fmt.Errorf("host not allowed: %s", request.Host))
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Handler returns the routes of the API and the web UI, requests for another host are refused
+func (server *Server) Handler() http.Handler {
+	assets, _ := fs.Sub(static, "static")
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	mux.HandleFunc("/api/report", server.handleReport)
+	mux.HandleFunc("/api/scan", server.handleScan)
+	mux.HandleFunc("/api/plan", server.handlePlan)
+	mux.HandleFunc("/api/apply", server.handleApply)
+	mux.HandleFunc("/api/sessions", server.handleSessions)
+	mux.HandleFunc("/api/restore", server.handleRestore)
+	return checkHost(mux)
+}
+
+// writeJSON writes the value as the response
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+// writeError writes the error as {"error": message}
+func writeError(writer http.ResponseWriter, status int, err error) {
+	writeJSON(writer, status, map[string]string{"error": err.Error()})
+}
+
+/*
+allow checks the method, a request that changes something must be JSON.
+A web page of another site can not send JSON to the loopback without a CORS preflight, which is never allowed.
+*/
+func allow(writer http.ResponseWriter, request *http.Request, method string) bool {
+	if request.Method != method {
+		writer.Header().Set("Allow", method)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", request.Method))
+		return false
+	}
+	if method != http.MethodGet {
+		mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		if mediaType != "application/json" {
+			writeError(writer, http.StatusUnsupportedMediaType, errors.New("content type must be application/json"))
+			return false
+		}
+	}
+	return true
+}
+
+// GET /api/report returns the report of the last scan
+func (server *Server) handleReport(writer http.ResponseWriter, request *http.Request) {
+	if !allow(writer, request, http.MethodGet) {
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.report == nil {
+		writeError(writer, http.StatusNotFound, errors.New("no scan yet"))
+		return
+	}
+	writeJSON(writer, http.StatusOK, server.report)
+}
+
+// POST /api/scan runs all strategies in dry-run mode and makes a new plan of the report
+func (server *Server) handleScan(writer http.ResponseWriter, request *http.Request) {
+	if !allow(writer, request, http.MethodPost) {
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	cmd := server.cmd
+	cmd.DryRun = true
+	report, err := server.config.Execute(request.Context(), cmd)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	server.report = report
+	server.plan = file_cleaner.NewPlan(report)
+	if err := server.savePlan(); err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(writer, http.StatusOK, report)
+}
+
+// GET /api/plan returns the plan, PUT /api/plan changes which files of the plan are selected
+func (server *Server) handlePlan(writer http.ResponseWriter, request *http.Request) {
+	method := http.MethodGet
+	if request.Method == http.MethodPut {
+		method = http.MethodPut
+	}
+	if !allow(writer, request, method) {
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if method == http.MethodPut {
+		if server.plan == nil {
+			writeError(writer, http.StatusNotFound, errors.New("no plan yet, run a scan"))
+			return
+		}
+		plan := new(file_cleaner.Plan)
+		if err := json.NewDecoder(request.Body).Decode(plan); err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+		if err := selectFiles(server.plan, plan); err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+		if err := server.savePlan(); err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if server.plan == nil {
+		writeError(writer, http.StatusNotFound, errors.New("no plan yet, run a scan"))
+		return
+	}
+	writeJSON(writer, http.StatusOK, server.plan)
+}
+
+/*
+selectFiles copies the selected flags of the client plan to the plan of the server. Only the selection
+can change, a group or file that is not in the plan of the server is refused and nothing is changed.
+*/
+func selectFiles(plan *file_cleaner.Plan, client *file_cleaner.Plan) error {
+	groups := make(map[[2]string]*file_cleaner.PlanGroup)
+	for i := range plan.Groups {
+		group := &plan.Groups[i]
+		groups[[2]string{group.TrashDir, group.Keep}] = group
+	}
+
+	selected := make(map[*file_cleaner.PlanFile]bool)
+	for _, clientGroup := range client.Groups {
+		group, ok := groups[[2]string{clientGroup.TrashDir, clientGroup.Keep}]
+		if !ok {
+			return fmt.Errorf("group not in the plan: %s", clientGroup.Keep)
+		}
+		for _, clientFile := range clientGroup.Files {
+			file := findFile(group, clientFile.Path)
+			if file == nil {
+				return fmt.Errorf("file not in the plan: %s", clientFile.Path)
+			}
+			selected[file] = clientFile.Selected
+		}
+	}
+
+	for file, value := range selected {
+		file.Selected = value
+	}
+	return nil
+}
+
+// findFile returns the file of the group with the path, nil if there is none
+func findFile(group *file_cleaner.PlanGroup, path string) *file_cleaner.PlanFile {
+	for i := range group.Files {
+		if group.Files[i].Path == path {
+			return &group.Files[i]
+		}
+	}
+	return nil
+}
+
+// savePlan writes the plan to planPath
+func (server *Server) savePlan() error {
+	if server.planPath == "" || server.plan == nil {
+		return nil
+	}
+	return server.plan.Save(server.planPath)
+}
+
+// POST /api/apply applies the plan, the files are compared again right before they are moved
+func (server *Server) handleApply(writer http.ResponseWriter, request *http.Request) {
+	if !allow(writer, request, http.MethodPost) {
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.plan == nil {
+		writeError(writer, http.StatusNotFound, errors.New("no plan yet, run a scan"))
+		return
+	}
+	// the plan file may have been edited, it must not move files the config would never touch
+	if err := server.plan.Check(server.config); err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	// the apply is not stopped if the browser goes away
+	report, err := server.plan.Apply(context.Background(), server.config.FS(), server.cmd)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(writer, http.StatusOK, report)
+}
+
+// GET /api/sessions lists the trash sessions of all strategies
+func (server *Server) handleSessions(writer http.ResponseWriter, request *http.Request) {
+	if !allow(writer, request, http.MethodGet) {
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	sessions := []file_cleaner.TrashSession{}
+	for _, root := range server.config.TrashRoots() {
+		found, err := file_cleaner.TrashSessions(server.config.FS(), root)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		sessions = append(sessions, found...)
+	}
+	writeJSON(writer, http.StatusOK, sessions)
+}
+
+// inTrash returns true if the session is a directory right below a `trash_dir` of the config
+func (server *Server) inTrash(session string) bool {
+	for _, root := range server.config.TrashRoots() {
+		rel, err := filepath.Rel(root, session)
+		if err == nil && filepath.IsLocal(rel) && !strings.ContainsRune(rel, filepath.Separator) {
+			return true
+		}
+	}
+	return false
+}
+
+// POST /api/restore moves the files of a trash session back, it returns the restored records
+func (server *Server) handleRestore(writer http.ResponseWriter, request *http.Request) {
+	if !allow(writer, request, http.MethodPost) {
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	var restore RestoreRequest
+	if err := json.NewDecoder(request.Body).Decode(&restore); err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+	if !server.inTrash(restore.Session) {
+		writeError(writer, http.StatusBadRequest, fmt.Errorf("not a trash session: %s", restore.Session))
+		return
+	}
+
+	records, err := file_cleaner.Restore(server.config.FS(), restore.Session, restore.Paths)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return
+	}
+	if records == nil {
+		records = []file_cleaner.ManifestRecord{}
+	}
+	writeJSON(writer, http.StatusOK, records)
+}
@@ -0,0 +1,189 @@
+// the plan of the last scan, the checkboxes change the selected flags
+let plan = null;
+
+const status = (text) => { document.getElementById("status").textContent = text; };
+
+async function api(method, path, body) {
+  const options = { method, headers: {} };
+  if (method !== "GET") {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body || {});
+  }
+  const response = await fetch(path, options);
+  const value = await response.json();
+  if (!response.ok) {
+    throw new Error(value.error || response.statusText);
+  }
+  return value;
+}
+
+function formatSize(size) {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+  let i = 0;
+  while (size >= 1024 && i < units.length - 1) {
+    size /= 1024;
+    i++;
+  }
+  return i === 0 ? size + " B" : size.toFixed(1) + " " + units[i];
+}
+
+function reclaimable(group) {
+  return group.files.filter((file) => file.selected).length * group.size;
+}
+
+function matches(group, filter) {
+  if (filter === "") {
+    return true;
+  }
+  const paths = [group.keep, ...group.files.map((file) => file.path)];
+  if (filter.startsWith(".") && !filter.includes("/")) {
+    return paths.some((path) => path.toLowerCase().endsWith(filter.toLowerCase()));
+  }
+  return paths.some((path) => path.includes(filter));
+}
+
+function renderPlan() {
+  const root = document.getElementById("groups");
+  root.replaceChildren();
+  if (!plan) {
+    root.textContent = "No plan yet, run a scan.";
+    return;
+  }
+
+  const filter = document.getElementById("filter").value;
+  let total = 0;
+  for (const group of plan.groups) {
+    total += reclaimable(group);
+    if (!matches(group, filter)) {
+      continue;
+    }
+
+    const details = document.createElement("details");
+    const summary = document.createElement("summary");
+    const size = document.createElement("span");
+    size.className = "size";
+    size.textContent = formatSize(reclaimable(group));
+    summary.append(size, group.keep + " (" + group.files.length + " duplicates)");
+
+    const files = document.createElement("div");
+    files.className = "files";
+    const keep = document.createElement("div");
+    keep.className = "keep";
+    keep.textContent = "keep " + group.keep;
+    files.append(keep);
+    for (const file of group.files) {
+      const label = document.createElement("label");
+      const box = document.createElement("input");
+      box.type = "checkbox";
+      box.checked = file.selected;
+      box.onchange = () => {
+        file.selected = box.checked;
+        renderPlan();
+      };
+      label.append(box, " " + file.path);
+      files.append(label);
+    }
+    details.open = root.dataset.open === group.keep;
+    details.ontoggle = () => { if (details.open) root.dataset.open = group.keep; };
+    details.append(summary, files);
+    root.append(details);
+  }
+  document.getElementById("reclaimable").textContent = formatSize(total) + " selected";
+}
+
+async function loadPlan() {
+  try {
+    plan = await api("GET", "/api/plan");
+  } catch (error) {
+    plan = null;
+  }
+  renderPlan();
+}
+
+async function loadSessions() {
+  const root = document.getElementById("sessions");
+  root.replaceChildren();
+  const sessions = await api("GET", "/api/sessions");
+  if (sessions.length === 0) {
+    root.textContent = "No trash sessions.";
+  }
+  for (const session of sessions) {
+    const details = document.createElement("details");
+    const summary = document.createElement("summary");
+    summary.textContent = session.path + " (" + session.records.length + " operations) ";
+    const restore = document.createElement("button");
+    restore.textContent = "Restore all";
+    restore.onclick = () => restorePaths(session.path, []);
+    summary.append(restore);
+
+    const table = document.createElement("table");
+    for (const record of session.records) {
+      const row = table.insertRow();
+      row.insertCell().textContent = record.action;
+      row.insertCell().textContent = record.from;
+      row.insertCell().textContent = record.to;
+      const button = document.createElement("button");
+      button.textContent = "Restore";
+      button.onclick = () => restorePaths(session.path, [record.action === "symlink" ? record.to : record.from]);
+      row.insertCell().append(button);
+    }
+    details.append(summary, table);
+    root.append(details);
+  }
+}
+
+async function restorePaths(session, paths) {
+  try {
+    const restored = await api("POST", "/api/restore", { session, paths });
+    status("Restored " + restored.length + " operations");
+  } catch (error) {
+    status("Error: " + error.message);
+  }
+  await loadSessions();
+}
+
+document.getElementById("scan").onclick = async () => {
+  status("Scanning...");
+  try {
+    await api("POST", "/api/scan");
+    status("Scan finished");
+  } catch (error) {
+    status("Error: " + error.message);
+  }
+  await loadPlan();
+};
+
+document.getElementById("save").onclick = async () => {
+  try {
+    plan = await api("PUT", "/api/plan", plan);
+    status("Saved");
+  } catch (error) {
+    status("Error: " + error.message);
+  }
+  renderPlan();
+};
+
+document.getElementById("apply").onclick = async () => {
+  if (!plan) {
+    return;
+  }
+  const total = plan.groups.reduce((sum, group) => sum + reclaimable(group), 0);
+  if (!confirm("Apply the plan and move " + formatSize(total) + " to trash?")) {
+    return;
+  }
+  try {
+    await api("PUT", "/api/plan", plan);
+    const report = await api("POST", "/api/apply");
+    const moved = report.entries.filter((entry) => entry.kind === "duplicate").length;
+    const changed = report.entries.filter((entry) => entry.kind === "changed").length;
+    status("Applied: " + moved + " duplicates, " + changed + " changed since the scan");
+  } catch (error) {
+    status("Error: " + error.message);
+  }
+  await loadSessions();
+};
+
+document.getElementById("filter").oninput = renderPlan;
+
+loadPlan();
+loadSessions();